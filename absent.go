@@ -0,0 +1,45 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+)
+
+// tombstoneHeader is the value stored by SetAbsent to
+// mark a key as known to be absent.
+const tombstoneHeader byte = 0x19
+
+// isTombstone reports whether a value retrieved from the
+// store is a tombstone.
+func isTombstone(buf []byte) bool {
+	return len(buf) == 1 && buf[0] == tombstoneHeader
+}
+
+// SetAbsent stores a tombstone for the key, marking it as
+// known to be absent from the source. Get returns
+// ErrAbsent for the key until the tombstone expires or is
+// replaced. The tombstone expires after the options'
+// AbsentExpiration, or Expiration if it is not set.
+func (c *Cache) SetAbsent(ctx context.Context, key interface{}, options Options) error {
+	if err := c.life.acquire(); err != nil {
+		return err
+	}
+	defer c.life.release()
+	ctx, start := c.start(ctx, OperationSetAbsent)
+	err := c.set(ctx, key, []byte{tombstoneHeader}, absentOptions(options))
+	c.observe(ctx, start, Event{Operation: OperationSetAbsent, Keys: []string{c.key(key)}, Size: 1, Err: err})
+	return err
+}
+
+// absentOptions returns the options used to store a
+// tombstone.
+func absentOptions(options Options) Options {
+	if options.AbsentExpiration != 0 {
+		options.Expiration = options.AbsentExpiration
+	}
+	options.Grace = 0
+	return options
+}
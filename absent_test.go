@@ -0,0 +1,67 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func (t *StashTestSuite) TestAbsentOptions() {
+	o := absentOptions(Options{Expiration: time.Hour, Grace: time.Hour, AbsentExpiration: time.Minute, Tags: []string{"tag"}})
+	t.Equal(Options{Expiration: time.Minute, AbsentExpiration: time.Minute, Tags: []string{"tag"}}, o)
+
+	o = absentOptions(Options{Expiration: time.Hour})
+	t.Equal(Options{Expiration: time.Hour}, o)
+}
+
+func (t *StashTestSuite) TestRemember_Absent() {
+	r := &recorder{}
+	c, err := Load(NewMemory(time.Hour, time.Hour), WithInstrumentation(r))
+	t.NoError(err)
+	ctx := context.Background()
+
+	calls := 0
+	loader := func(ctx context.Context) (interface{}, error) {
+		calls++
+		return nil, fmt.Errorf("user 42: %w", ErrNotFound)
+	}
+
+	var got string
+	o := Options{Expiration: time.Hour, AbsentExpiration: time.Minute}
+	t.ErrorIs(c.Remember(ctx, "key", &got, o, loader), ErrAbsent)
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationRemember, Misses: 1}, r.last())
+	t.ErrorIs(c.Remember(ctx, "key", &got, o, loader), ErrAbsent)
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationRemember, Hits: 1, Size: 1}, r.last())
+	t.Equal(1, calls)
+
+	ttl, err := c.TTL(ctx, "key")
+	t.NoError(err)
+	t.LessOrEqual(ttl, time.Minute)
+
+	// Without an AbsentExpiration the loader's error is
+	// returned and nothing is stored.
+	t.ErrorIs(c.Remember(ctx, "other", &got, Options{}, loader), ErrNotFound)
+	_, err = c.TTL(ctx, "other")
+	t.ErrorIs(err, ErrNotFound)
+}
+
+func (t *StashTestSuite) TestTypedCache_SetAbsent() {
+	c, err := Load(NewMemory(time.Hour, time.Hour))
+	t.NoError(err)
+	ctx := context.Background()
+	tc := NewTypedCache[string, int](c)
+
+	t.NoError(tc.Set(ctx, "key", 1, Options{}))
+	t.NoError(tc.SetAbsent(ctx, "absent", Options{}))
+
+	_, err = tc.Get(ctx, "absent")
+	t.ErrorIs(err, ErrAbsent)
+
+	values, err := tc.GetMany(ctx, "key", "absent")
+	t.NoError(err)
+	t.Equal(map[string]int{"key": 1}, values)
+}
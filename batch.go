@@ -0,0 +1,319 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"errors"
+	"github.com/eko/gocache/v2/store"
+)
+
+// Item defines a single item to store when calling
+// SetMany.
+type Item struct {
+	// Key is the key of the item.
+	Key interface{}
+	// Value is the value to be marshalled and stored.
+	Value interface{}
+	// Options are the tags and expiration time of the
+	// item.
+	Options Options
+}
+
+// Result defines the outcome of a single key within a
+// batch operation.
+type Result struct {
+	// Key is the key the result belongs to.
+	Key interface{}
+	// Err is the error for the key, ErrNotFound is used
+	// when the key does not exist in GetMany and ErrAbsent
+	// when it has been marked as absent.
+	Err   error
+	value interface{}
+	cache *Cache
+}
+
+// Decode unmarshalls the value retrieved by GetMany into
+// v, returning the result's error if there is one.
+func (r Result) Decode(v interface{}) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	if r.cache == nil {
+		return ErrEmptyValue
+	}
+	return r.cache.unmarshal(toBytes(r.value), v)
+}
+
+// Results defines the outcome of a batch operation, in
+// the same order as the keys or items passed.
+type Results []Result
+
+// Err returns the first error within the results that
+// is not ErrNotFound or ErrAbsent, or nil if there is none.
+func (r Results) Err() error {
+	for _, result := range r {
+		if result.Err != nil && !errors.Is(result.Err, ErrNotFound) && !errors.Is(result.Err, ErrAbsent) {
+			return result.Err
+		}
+	}
+	return nil
+}
+
+// BatchItem defines a marshalled item passed to a
+// BatchSetter.
+type BatchItem struct {
+	Key     string
+	Value   []byte
+	Options *store.Options
+}
+
+// BatchGetter is implemented by stores that can
+// retrieve multiple keys in a single round trip. The
+// values and errors returned are in the same order as
+// the keys passed.
+type BatchGetter interface {
+	GetMany(ctx context.Context, keys []string) ([]interface{}, []error)
+}
+
+// BatchSetter is implemented by stores that can store
+// multiple items in a single round trip. The errors
+// returned are in the same order as the items passed.
+type BatchSetter interface {
+	SetMany(ctx context.Context, items []BatchItem) []error
+}
+
+// BatchDeleter is implemented by stores that can remove
+// multiple keys in a single round trip. The errors
+// returned are in the same order as the keys passed.
+type BatchDeleter interface {
+	DeleteMany(ctx context.Context, keys []string) []error
+}
+
+// GetMany retrieves multiple items from the cache by key.
+// Use Result.Decode to unmarshal each value, keys that do
+// not exist have an Err of ErrNotFound. Stores that
+// implement BatchGetter retrieve all keys in a single
+// round trip.
+func (c *Cache) GetMany(ctx context.Context, keys ...interface{}) Results {
+	if err := c.life.acquire(); err != nil {
+		return closedResults(keys)
+	}
+	defer c.life.release()
+	results := make(Results, len(keys))
+	strKeys := make([]string, len(keys))
+	for i, key := range keys {
+		results[i] = Result{Key: key, cache: c}
+		strKeys[i] = c.key(key)
+	}
+
+	ctx, start := c.start(ctx, OperationGetMany)
+	size := c.getMany(ctx, strKeys, results)
+	c.observeResults(ctx, start, OperationGetMany, strKeys, size, results)
+
+	return results
+}
+
+// getMany retrieves the keys from the store into the
+// results, returning the total size of the values found.
+func (c *Cache) getMany(ctx context.Context, strKeys []string, results Results) int {
+	if bg, ok := c.store.(BatchGetter); ok && len(c.middleware) == 0 {
+		keys, err := c.storeKeys(ctx, strKeys)
+		if err != nil {
+			for i := range results {
+				results[i].Err = err
+			}
+			return 0
+		}
+		values, errs := bg.GetMany(ctx, keys)
+		for i := range results {
+			results[i].value, results[i].Err = values[i], notFound(errs[i])
+		}
+	} else {
+		for i, key := range strKeys {
+			call := &Call{Operation: OperationGet, Key: key}
+			results[i].Err = c.handle(ctx, call)
+			results[i].value = call.Value
+		}
+	}
+
+	size := 0
+	for i, result := range results {
+		size += payloadSize(result.value)
+		if result.Err == nil {
+			results[i].value, _, results[i].Err = c.unwrap(strKeys[i], result.value)
+		}
+	}
+
+	return size
+}
+
+// SetMany stores multiple items in the cache. Values are
+// automatically marshalled, items that fail to marshal
+// are not stored. Stores that implement BatchSetter store
+// all items in a single round trip.
+func (c *Cache) SetMany(ctx context.Context, items ...Item) Results {
+	if err := c.life.acquire(); err != nil {
+		keys := make([]interface{}, len(items))
+		for i, item := range items {
+			keys[i] = item.Key
+		}
+		return closedResults(keys)
+	}
+	defer c.life.release()
+	ctx, start := c.start(ctx, OperationSetMany)
+	size := 0
+	results := make(Results, len(items))
+	keys := make([]string, len(items))
+	batch := make([]BatchItem, 0, len(items))
+	batchOptions := make([]Options, 0, len(items))
+	index := make([]int, 0, len(items))
+	lockKeys := make([]interface{}, 0, len(items))
+
+	for i, item := range items {
+		results[i] = Result{Key: item.Key}
+		keys[i] = c.key(item.Key)
+		marshal, err := c.marshal(item.Value)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		size += len(marshal)
+		value, options := withGrace(marshal, item.Options)
+		value, err = c.seal(keys[i], value)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		options = c.storeOptions(options)
+		batch = append(batch, BatchItem{
+			Key:     keys[i],
+			Value:   value,
+			Options: options.toStore(),
+		})
+		batchOptions = append(batchOptions, options)
+		index = append(index, i)
+		lockKeys = append(lockKeys, c.lockKeys(item.Key, item.Options.Tags)...)
+	}
+
+	defer c.locks.lock(lockKeys...)()
+
+	if bs, ok := c.store.(BatchSetter); ok && len(c.middleware) == 0 {
+		errs, err := c.setMany(ctx, bs, batch)
+		for i := range batch {
+			results[index[i]].Err = err
+			if err == nil {
+				results[index[i]].Err = errs[i]
+			}
+		}
+	} else {
+		for i, item := range batch {
+			call := &Call{Operation: OperationSet, Key: item.Key, Value: item.Value, Options: batchOptions[i]}
+			results[index[i]].Err = c.handle(ctx, call)
+			keys[index[i]] = call.Key
+		}
+	}
+
+	c.publishResults(ctx, keys, results)
+	c.observeResults(ctx, start, OperationSetMany, storeKeys(batch), size, results)
+
+	return results
+}
+
+// setMany stores the batch with the BatchSetter, using
+// the keys as they are held within the store.
+func (c *Cache) setMany(ctx context.Context, bs BatchSetter, batch []BatchItem) ([]error, error) {
+	keys, err := c.storeKeys(ctx, storeKeys(batch))
+	if err != nil {
+		return nil, err
+	}
+	items := make([]BatchItem, len(batch))
+	for i, item := range batch {
+		items[i] = item
+		items[i].Key = keys[i]
+	}
+	return bs.SetMany(ctx, items), nil
+}
+
+// DeleteMany removes multiple items from the cache by
+// key. Stores that implement BatchDeleter remove all keys
+// in a single round trip.
+func (c *Cache) DeleteMany(ctx context.Context, keys ...interface{}) Results {
+	if err := c.life.acquire(); err != nil {
+		return closedResults(keys)
+	}
+	defer c.life.release()
+	ctx, start := c.start(ctx, OperationDeleteMany)
+	results := make(Results, len(keys))
+	strKeys := make([]string, len(keys))
+	lockKeys := make([]interface{}, len(keys))
+	for i, key := range keys {
+		results[i] = Result{Key: key}
+		strKeys[i] = c.key(key)
+		lockKeys[i] = strKeys[i]
+	}
+
+	defer c.locks.lock(lockKeys...)()
+
+	if bd, ok := c.store.(BatchDeleter); ok && len(c.middleware) == 0 {
+		keys, err := c.storeKeys(ctx, strKeys)
+		for i := range results {
+			results[i].Err = err
+		}
+		if err == nil {
+			for i, err := range bd.DeleteMany(ctx, keys) {
+				results[i].Err = err
+			}
+		}
+	} else {
+		for i, key := range strKeys {
+			call := &Call{Operation: OperationDelete, Key: key}
+			results[i].Err = c.handle(ctx, call)
+			strKeys[i] = call.Key
+		}
+	}
+
+	c.publishResults(ctx, strKeys, results)
+	c.observeResults(ctx, start, OperationDeleteMany, strKeys, 0, results)
+
+	return results
+}
+
+// publishResults broadcasts the keys of the successful
+// results over the invalidation bus, a publish error is
+// assigned to every successful result. keys are the store
+// keys of the results, in the same order.
+func (c *Cache) publishResults(ctx context.Context, keys []string, results Results) {
+	if c.bus == nil {
+		return
+	}
+	published := make([]string, 0, len(results))
+	for i, result := range results {
+		if result.Err == nil {
+			published = append(published, keys[i])
+		}
+	}
+	if len(published) == 0 {
+		return
+	}
+	err := c.publish(ctx, Invalidation{Keys: published})
+	if err == nil {
+		return
+	}
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Err = err
+		}
+	}
+}
+
+// storeKeys returns the keys of the batch items.
+func storeKeys(items []BatchItem) []string {
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+	return keys
+}
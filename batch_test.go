@@ -0,0 +1,82 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/lacuna-seo/stash/mocks"
+	"github.com/stretchr/testify/mock"
+)
+
+func (t *StashTestSuite) TestStash_GetMany() {
+	c := t.Setup(func(m *mocks.StoreInterface) {
+		m.On("Get", mock.Anything, "one").Return("\"1\"", nil)
+		m.On("Get", mock.Anything, "two").Return(nil, redis.Nil)
+		m.On("Get", mock.Anything, "three").Return(nil, errors.New("get error"))
+	})
+
+	got := c.GetMany(context.Background(), "one", "two", "three")
+	t.Len(got, 3)
+
+	var s string
+	t.NoError(got[0].Decode(&s))
+	t.Equal("1", s)
+	t.Equal("one", got[0].Key)
+	t.ErrorIs(got[1].Decode(&s), ErrNotFound)
+	t.EqualError(got[2].Decode(&s), "get error")
+	t.EqualError(got.Err(), "get error")
+}
+
+func (t *StashTestSuite) TestStash_SetMany() {
+	c := t.Setup(func(m *mocks.StoreInterface) {
+		m.On("Set", mock.Anything, "one", mock.Anything, mock.Anything).Return(nil)
+		m.On("Set", mock.Anything, "two", mock.Anything, mock.Anything).Return(errors.New("set error"))
+	})
+
+	got := c.SetMany(context.Background(),
+		Item{Key: "one", Value: 1},
+		Item{Key: "two", Value: 2},
+		Item{Key: "three", Value: make(chan bool)},
+	)
+	t.Len(got, 3)
+	t.NoError(got[0].Err)
+	t.EqualError(got[1].Err, "set error")
+	t.Contains(got[2].Err.Error(), "json: unsupported type")
+}
+
+func (t *StashTestSuite) TestStash_DeleteMany() {
+	c := t.Setup(func(m *mocks.StoreInterface) {
+		m.On("Delete", mock.Anything, "one").Return(nil)
+		m.On("Delete", mock.Anything, "two").Return(errors.New("delete error"))
+	})
+
+	got := c.DeleteMany(context.Background(), "one", "two")
+	t.Len(got, 2)
+	t.NoError(got[0].Err)
+	t.EqualError(got[1].Err, "delete error")
+}
+
+func (t *StashTestSuite) TestResults_Err() {
+	t.Nil(Results{}.Err())
+	t.Nil(Results{{Err: ErrNotFound}}.Err())
+	t.EqualError(Results{{Err: ErrNotFound}, {Err: errors.New("error")}}.Err(), "error")
+	t.ErrorIs(Result{}.Decode(nil), ErrEmptyValue)
+}
+
+func (t *StashTestSuite) TestBatchStores_Empty() {
+	r := &redisExtendedStore{}
+	values, errs := r.GetMany(context.Background(), nil)
+	t.Empty(values)
+	t.Empty(errs)
+	t.Empty(r.SetMany(context.Background(), nil))
+	t.Empty(r.DeleteMany(context.Background(), nil))
+
+	m := &memcacheExtendedStore{}
+	values, errs = m.GetMany(context.Background(), nil)
+	t.Empty(values)
+	t.Empty(errs)
+}
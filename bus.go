@@ -0,0 +1,172 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/eko/gocache/v2/store"
+)
+
+// Invalidation defines a message broadcast over an
+// InvalidationBus when items are removed or changed
+// through a Cache. Keys, tags and namespaces are in the
+// form used within the store.
+type Invalidation struct {
+	// Source is the ID of the Cache that issued the
+	// invalidation, caches ignore their own messages.
+	Source string `json:"source"`
+	// Keys are the keys to evict.
+	Keys []string `json:"keys,omitempty"`
+	// Tags are the tags to invalidate.
+	Tags []string `json:"tags,omitempty"`
+	// Clear is true when the cache was cleared.
+	Clear bool `json:"clear,omitempty"`
+	// Namespace is the namespace that was cleared, it is
+	// empty if the entire store was cleared.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// InvalidationBus defines the methods for broadcasting
+// invalidations between instances of a cache, so each
+// instance can evict items from its local tier.
+type InvalidationBus interface {
+	// Publish broadcasts the invalidation to every
+	// subscriber.
+	Publish(ctx context.Context, msg Invalidation) error
+
+	// Subscribe calls fn for every invalidation received
+	// until the bus is closed. It returns once the
+	// subscription is active.
+	Subscribe(ctx context.Context, fn func(msg Invalidation)) error
+
+	// Close stops all subscriptions.
+	Close() error
+}
+
+// TagResolver is implemented by stores that can list the
+// keys associated with tags. It is used to broadcast the
+// keys of invalidated tags, as items back-filled into a
+// local tier are not tagged.
+type TagResolver interface {
+	TagKeys(ctx context.Context, tags []string) ([]string, error)
+}
+
+// WithInvalidationBus broadcasts the keys and tags of
+// every Set, Delete, Invalidate and Clear issued through
+// the Cache over the bus, and subscribes to invalidations
+// from other instances to evict them locally.
+//
+// local is the provider for the tier that is local to
+// each instance, such as the memory provider passed to
+// NewChain. Invalidations are only ever applied to it, as
+// evicting from a shared store would remove the items
+// another instance has just written. local may only be nil
+// when the Cache uses the memory Driver, in which case
+// invalidations are applied to the Cache's own store.
+//
+// The bus is closed when the Cache is closed.
+func WithInvalidationBus(bus InvalidationBus, local Provider) LoadOption {
+	return func(c *Cache) {
+		c.bus = &busConfig{
+			bus:   bus,
+			local: local,
+		}
+	}
+}
+
+// busConfig defines the invalidation bus configuration
+// for a Cache.
+type busConfig struct {
+	bus   InvalidationBus
+	local Provider
+	store store.StoreInterface
+	id    string
+}
+
+// subscribe assigns the cache an ID and subscribes to the
+// bus.
+func (c *Cache) subscribe(ctx context.Context) error {
+	if c.bus.bus == nil {
+		return errors.New("invalidation bus cannot be nil")
+	}
+
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return err
+	}
+	c.bus.id = hex.EncodeToString(buf)
+
+	switch {
+	case c.bus.local != nil:
+		c.bus.store = c.bus.local.Store()
+	case c.Driver == MemoryDriver:
+		c.bus.store = c.store
+	default:
+		return fmt.Errorf("invalidation bus requires a local provider for the %s driver", c.Driver)
+	}
+
+	return c.bus.bus.Subscribe(ctx, c.evict)
+}
+
+// publish broadcasts an invalidation if the cache has a
+// bus configured.
+func (c *Cache) publish(ctx context.Context, msg Invalidation) error {
+	if c.bus == nil {
+		return nil
+	}
+	msg.Source = c.bus.id
+	err := c.bus.bus.Publish(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("stash: publishing invalidation: %w", err)
+	}
+	return nil
+}
+
+// evict applies an invalidation received from another
+// instance to the local store.
+func (c *Cache) evict(msg Invalidation) {
+	if msg.Source == c.bus.id {
+		return
+	}
+
+	ctx := context.Background()
+	s := c.bus.store
+
+	if msg.Clear {
+		defer c.locks.lockAll()()
+		_ = clearNamespace(ctx, s, msg.Namespace)
+		return
+	}
+
+	for _, key := range msg.Keys {
+		func() {
+			defer c.locks.lock(key)()
+			_ = s.Delete(ctx, key)
+		}()
+	}
+
+	if len(msg.Tags) > 0 {
+		defer c.locks.lock(tagKeys(msg.Tags)...)()
+		_ = s.Invalidate(ctx, store.InvalidateOptions{Tags: msg.Tags})
+	}
+}
+
+// tagKeys resolves the keys for the tags when the cache
+// has a bus and the store implements TagResolver.
+func (c *Cache) tagKeys(ctx context.Context, tags []string) ([]string, error) {
+	if c.bus == nil || len(tags) == 0 {
+		return nil, nil
+	}
+	tr, ok := c.store.(TagResolver)
+	if !ok {
+		return nil, nil
+	}
+	return tr.TagKeys(ctx, tags)
+}
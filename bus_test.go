@@ -0,0 +1,164 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"sync"
+	"time"
+)
+
+// fakeBus is an in-process InvalidationBus.
+type fakeBus struct {
+	mtx        sync.Mutex
+	subs       []func(msg Invalidation)
+	published  []Invalidation
+	publishErr error
+	subErr     error
+	closed     bool
+}
+
+func (f *fakeBus) Publish(_ context.Context, msg Invalidation) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.publishErr != nil {
+		return f.publishErr
+	}
+	f.published = append(f.published, msg)
+	for _, fn := range f.subs {
+		fn(msg)
+	}
+	return nil
+}
+
+func (f *fakeBus) Subscribe(_ context.Context, fn func(msg Invalidation)) error {
+	if f.subErr != nil {
+		return f.subErr
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.subs = append(f.subs, fn)
+	return nil
+}
+
+func (f *fakeBus) Close() error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.subs = nil
+	f.closed = true
+	return nil
+}
+
+func (t *StashTestSuite) TestInvalidationBus() {
+	bus := &fakeBus{}
+	shared := NewMemory(time.Hour, time.Hour)
+	l1a, l1b := NewMemory(time.Hour, time.Hour), NewMemory(time.Hour, time.Hour)
+
+	a, err := Load(NewChain(time.Minute, l1a, shared), WithInvalidationBus(bus, l1a), WithNamespace("svc"))
+	t.NoError(err)
+	b, err := Load(NewChain(time.Minute, l1b, shared), WithInvalidationBus(bus, l1b), WithNamespace("svc"))
+	t.NoError(err)
+	t.NotEqual(a.bus.id, b.bus.id)
+
+	l1bCache, err := Load(l1b, WithNamespace("svc"))
+	t.NoError(err)
+
+	ctx := context.Background()
+	var got string
+
+	// Populate b's local tier then set from a, b evicts.
+	t.NoError(b.Set(ctx, "key", "b", Options{Tags: []string{"tag"}}))
+	t.NoError(a.Set(ctx, "key", "a", Options{Tags: []string{"tag"}}))
+	t.ErrorIs(l1bCache.Get(ctx, "key", &got), ErrNotFound)
+	t.NoError(b.Get(ctx, "key", &got))
+	t.Equal("a", got)
+
+	// Delete.
+	t.NoError(a.Delete(ctx, "key"))
+	t.ErrorIs(l1bCache.Get(ctx, "key", &got), ErrNotFound)
+
+	// Invalidate.
+	t.NoError(b.Set(ctx, "key", "b", Options{Tags: []string{"tag"}}))
+	t.NoError(a.Invalidate(ctx, InvalidateOptions{Tags: []string{"tag"}}))
+	t.ErrorIs(l1bCache.Get(ctx, "key", &got), ErrNotFound)
+
+	// Batch.
+	t.NoError(b.SetMany(ctx, Item{Key: "one", Value: 1}).Err())
+	t.NoError(a.DeleteMany(ctx, "one").Err())
+	t.ErrorIs(l1bCache.Get(ctx, "one", &got), ErrNotFound)
+
+	// Clear.
+	t.NoError(b.Set(ctx, "key", "b", Options{}))
+	t.NoError(a.Clear(ctx))
+	t.ErrorIs(l1bCache.Get(ctx, "key", &got), ErrNotFound)
+
+	t.Equal(bus.published[0].Keys, []string{"svc:key"})
+	t.True(bus.published[len(bus.published)-1].Clear)
+	t.Equal("svc:", bus.published[len(bus.published)-1].Namespace)
+}
+
+func (t *StashTestSuite) TestInvalidationBus_OwnStore() {
+	bus := &fakeBus{}
+	a, err := Load(NewMemory(time.Hour, time.Hour), WithInvalidationBus(bus, nil))
+	t.NoError(err)
+	t.Equal(a.store, a.bus.store)
+
+	// Messages from the same instance are ignored.
+	ctx := context.Background()
+	t.NoError(a.Set(ctx, "key", "a", Options{}))
+	var got string
+	t.NoError(a.Get(ctx, "key", &got))
+}
+
+func (t *StashTestSuite) TestInvalidationBus_SharedStore() {
+	mr := miniredis.RunT(t.T())
+	bus := &fakeBus{}
+
+	// Evicting from the shared store would delete the
+	// writes of other instances.
+	_, err := Load(NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour), WithInvalidationBus(bus, nil))
+	t.EqualError(err, "invalidation bus requires a local provider for the redis driver")
+
+	l1a, l1b := NewMemory(time.Hour, time.Hour), NewMemory(time.Hour, time.Hour)
+	a, err := Load(NewChain(time.Minute, l1a, NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour)), WithInvalidationBus(bus, l1a))
+	t.NoError(err)
+	b, err := Load(NewChain(time.Minute, l1b, NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour)), WithInvalidationBus(bus, l1b))
+	t.NoError(err)
+
+	ctx := context.Background()
+	var got string
+	t.NoError(a.Set(ctx, "key", "a", Options{}))
+	t.NoError(a.Get(ctx, "key", &got))
+	t.Equal("a", got)
+	t.True(mr.Exists("key"))
+
+	t.NoError(b.Set(ctx, "key", "b", Options{}))
+	t.NoError(a.Get(ctx, "key", &got))
+	t.Equal("b", got)
+	t.True(mr.Exists("key"))
+}
+
+func (t *StashTestSuite) TestInvalidationBus_Errors() {
+	_, err := Load(NewMemory(time.Hour, time.Hour), WithInvalidationBus(nil, nil))
+	t.EqualError(err, "invalidation bus cannot be nil")
+
+	_, err = Load(NewMemory(time.Hour, time.Hour), WithInvalidationBus(&fakeBus{subErr: errors.New("subscribe error")}, nil))
+	t.EqualError(err, "subscribe error")
+
+	bus := &fakeBus{}
+	c, err := Load(NewMemory(time.Hour, time.Hour), WithInvalidationBus(bus, nil))
+	t.NoError(err)
+	bus.publishErr = errors.New("publish error")
+
+	ctx := context.Background()
+	t.ErrorIs(c.Set(ctx, "key", "value", Options{}), bus.publishErr)
+	t.ErrorIs(c.Delete(ctx, "key"), bus.publishErr)
+	t.ErrorIs(c.Invalidate(ctx, InvalidateOptions{}), bus.publishErr)
+	t.ErrorIs(c.Clear(ctx), bus.publishErr)
+	t.ErrorIs(c.DeleteMany(ctx, "key").Err(), bus.publishErr)
+}
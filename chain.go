@@ -0,0 +1,342 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eko/gocache/v2/store"
+	"time"
+)
+
+// ChainType is the store type returned by the chain
+// store's GetType.
+const ChainType = "chain"
+
+// chainProvider defines the data stored for a multi tier
+// cache built from other providers.
+type chainProvider struct {
+	providers          []Provider
+	backfillExpiration time.Duration
+}
+
+// NewChain creates a multi tier store from the providers
+// passed and returns a provider. Reads go through each
+// tier in order and back-fill the tiers above on a hit
+// with the backfillExpiration, which should typically be
+// shorter than the expiration of the items. A
+// backfillExpiration of zero uses the tier's default.
+// Sets, deletes, invalidations and clears are sent to
+// every tier.
+//
+// For example, a memory cache in front of Redis:
+//
+//	stash.NewChain(time.Minute, stash.NewMemory(...), stash.NewRedis(...))
+func NewChain(backfillExpiration time.Duration, providers ...Provider) Provider {
+	return &chainProvider{
+		providers:          providers,
+		backfillExpiration: backfillExpiration,
+	}
+}
+
+// Validate satisfies the Provider interface by validating
+// every tier.
+func (c *chainProvider) Validate() error {
+	if len(c.providers) == 0 {
+		return errors.New("error: no providers defined for chain")
+	}
+	for _, p := range c.providers {
+		if p == nil {
+			return errors.New("error: chain provider cannot be nil")
+		}
+		err := p.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Driver satisfies the Provider interface by returning
+// the chain Driver name.
+func (c *chainProvider) Driver() string {
+	return ChainDriver
+}
+
+// Store satisfies the Provider interface by creating a
+// new store.StoreInterface that reads through each tier.
+func (c *chainProvider) Store() store.StoreInterface {
+	tiers := make([]store.StoreInterface, len(c.providers))
+	for i, p := range c.providers {
+		tiers[i] = p.Store()
+	}
+	return &chainStore{
+		tiers:              tiers,
+		backfillExpiration: c.backfillExpiration,
+	}
+}
+
+// Ping satisfies the Provider interface by pinging every
+// tier.
+func (c *chainProvider) Ping() error {
+	for _, p := range c.providers {
+		err := p.Ping()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close satisfies the Provider interface by closing every
+// tier, returning the first error.
+func (c *chainProvider) Close(ctx context.Context) error {
+	var first error
+	for _, p := range c.providers {
+		if err := p.Close(ctx); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// chainStore implements store.StoreInterface over multiple
+// tiers.
+type chainStore struct {
+	tiers              []store.StoreInterface
+	backfillExpiration time.Duration
+}
+
+// Get retrieves the key from the first tier that has it
+// and back-fills the tiers above. The last tier's error
+// is returned if no tier has the key.
+func (c *chainStore) Get(ctx context.Context, key interface{}) (interface{}, error) {
+	var lastErr error
+	for i, tier := range c.tiers {
+		value, err := tier.Get(ctx, key)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		c.backfill(ctx, i, key, value, c.backfillExpiration)
+		return value, nil
+	}
+	return nil, lastErr
+}
+
+// GetWithTTL retrieves the key and its TTL from the first
+// tier that has it and back-fills the tiers above with
+// the remaining TTL if it is shorter than the back-fill
+// expiration.
+func (c *chainStore) GetWithTTL(ctx context.Context, key interface{}) (interface{}, time.Duration, error) {
+	var lastErr error
+	for i, tier := range c.tiers {
+		value, ttl, err := tier.GetWithTTL(ctx, key)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		expiration := c.backfillExpiration
+		if ttl > 0 && (expiration <= 0 || ttl < expiration) {
+			expiration = ttl
+		}
+		c.backfill(ctx, i, key, value, expiration)
+		return value, ttl, nil
+	}
+	return nil, 0, lastErr
+}
+
+// backfill stores the value in every tier above the
+// index. Errors are ignored as the value has already been
+// retrieved successfully.
+func (c *chainStore) backfill(ctx context.Context, index int, key, value interface{}, expiration time.Duration) {
+	if s, ok := value.(string); ok {
+		value = []byte(s)
+	}
+	var options *store.Options
+	if expiration > 0 {
+		options = &store.Options{Expiration: expiration}
+	}
+	for i := 0; i < index; i++ {
+		_ = c.tiers[i].Set(ctx, key, value, options)
+	}
+}
+
+// Set stores the value in every tier, returning the
+// first error.
+func (c *chainStore) Set(ctx context.Context, key interface{}, value interface{}, options *store.Options) error {
+	return c.each(func(tier store.StoreInterface) error {
+		return tier.Set(ctx, key, value, options)
+	})
+}
+
+// Delete removes the key from every tier, returning the
+// first error. Keys that do not exist in a tier are
+// ignored.
+func (c *chainStore) Delete(ctx context.Context, key interface{}) error {
+	return c.each(func(tier store.StoreInterface) error {
+		err := tier.Delete(ctx, key)
+		if errors.Is(notFound(err), ErrNotFound) {
+			return nil
+		}
+		return err
+	})
+}
+
+// Invalidate invalidates the tags in every tier,
+// returning the first error. Items back-filled into upper
+// tiers are not tagged, so the keys for the tags are
+// resolved from every tier and deleted from all of them.
+func (c *chainStore) Invalidate(ctx context.Context, options store.InvalidateOptions) error {
+	keys, err := c.TagKeys(ctx, options.Tags)
+	if err != nil {
+		return err
+	}
+	return c.each(func(tier store.StoreInterface) error {
+		err := tier.Invalidate(ctx, options)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			err = tier.Delete(ctx, key)
+			if err != nil && !errors.Is(notFound(err), ErrNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// TagKeys satisfies the TagResolver interface by resolving
+// the tags in every tier that supports it, returning the
+// unique keys.
+func (c *chainStore) TagKeys(ctx context.Context, tags []string) ([]string, error) {
+	seen := make(map[string]struct{})
+	var keys []string
+	for _, tier := range c.tiers {
+		tr, ok := tier.(TagResolver)
+		if !ok {
+			continue
+		}
+		tierKeys, err := tr.TagKeys(ctx, tags)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range tierKeys {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Exists satisfies the ExistenceChecker interface by
+// checking each tier for the keys not found in the tiers
+// above it. Nothing is back-filled.
+func (c *chainStore) Exists(ctx context.Context, keys []string) ([]bool, error) {
+	found := make([]bool, len(keys))
+	index := make([]int, len(keys))
+	for i := range keys {
+		index[i] = i
+	}
+	for _, tier := range c.tiers {
+		if len(keys) == 0 {
+			break
+		}
+		tierFound, err := exists(ctx, tier, keys)
+		if err != nil {
+			return nil, err
+		}
+		missing, missingIndex := keys[:0:0], index[:0:0]
+		for i, ok := range tierFound {
+			if ok {
+				found[index[i]] = true
+				continue
+			}
+			missing = append(missing, keys[i])
+			missingIndex = append(missingIndex, index[i])
+		}
+		keys, index = missing, missingIndex
+	}
+	return found, nil
+}
+
+// Add satisfies the ConditionalSetter interface by adding
+// the item to the last tier, which decides whether it is
+// stored, before setting it in the tiers above.
+func (c *chainStore) Add(ctx context.Context, key string, value []byte, options *store.Options) error {
+	return c.setIf(ctx, key, value, options, false)
+}
+
+// Replace satisfies the ConditionalSetter interface by
+// replacing the item in the last tier, which decides
+// whether it is stored, before setting it in the tiers
+// above.
+func (c *chainStore) Replace(ctx context.Context, key string, value []byte, options *store.Options) error {
+	return c.setIf(ctx, key, value, options, true)
+}
+
+// setIf conditionally stores the item in the last tier
+// and sets it in the others, returning the first error.
+func (c *chainStore) setIf(ctx context.Context, key string, value []byte, options *store.Options, replace bool) error {
+	last := len(c.tiers) - 1
+	err := setIf(ctx, c.tiers[last], key, value, options, replace)
+	if err != nil {
+		return err
+	}
+	var first error
+	for _, tier := range c.tiers[:last] {
+		if err := tier.Set(ctx, key, value, options); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Clear removes all items from every tier, returning the
+// first error.
+func (c *chainStore) Clear(ctx context.Context) error {
+	return c.each(func(tier store.StoreInterface) error {
+		return tier.Clear(ctx)
+	})
+}
+
+// ClearPrefix satisfies the PrefixClearer interface by
+// removing every key beginning with the prefix from every
+// tier, returning the first error. Nothing is removed and
+// ErrNamespaceClear is returned if any tier cannot clear
+// by prefix.
+func (c *chainStore) ClearPrefix(ctx context.Context, prefix string) error {
+	for _, tier := range c.tiers {
+		if _, ok := tier.(PrefixClearer); !ok {
+			return fmt.Errorf("%w: the %s tier of the chain cannot clear by prefix", ErrNamespaceClear, tier.GetType())
+		}
+	}
+	return c.each(func(tier store.StoreInterface) error {
+		return tier.(PrefixClearer).ClearPrefix(ctx, prefix)
+	})
+}
+
+// GetType returns the store type.
+func (c *chainStore) GetType() string {
+	return ChainType
+}
+
+// each calls fn for every tier, every tier is called
+// regardless of errors and the first error is returned.
+func (c *chainStore) each(fn func(tier store.StoreInterface) error) error {
+	var first error
+	for _, tier := range c.tiers {
+		err := fn(tier)
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
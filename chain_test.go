@@ -0,0 +1,185 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/eko/gocache/v2/store"
+	"github.com/go-redis/redis/v8"
+	"github.com/lacuna-seo/stash/internal/memcachetest"
+	"github.com/lacuna-seo/stash/mocks"
+	"github.com/stretchr/testify/mock"
+	"time"
+)
+
+func (t *StashTestSuite) TestChain() {
+	got := NewChain(time.Minute, NewMemory(time.Hour, time.Hour))
+	t.NotNil(got)
+
+	t.UtilTestProviderSuccess(got, ChainDriver)
+	t.Nil(got.Ping())
+	t.Equal(ChainType, got.Store().GetType())
+
+	t.Contains(NewChain(time.Minute).Validate().Error(), "no providers")
+	t.Contains(NewChain(time.Minute, nil).Validate().Error(), "cannot be nil")
+}
+
+func (t *StashTestSuite) TestChain_ValidateError() {
+	m := &mocks.Provider{}
+	m.On("Validate").Return(errors.New("validate error"))
+	m.On("Ping").Return(errors.New("ping error"))
+	t.UtilTestProviderError(NewChain(time.Minute, NewMemory(time.Hour, time.Hour), m))
+}
+
+func (t *StashTestSuite) TestChain_ReadThrough() {
+	mr := miniredis.RunT(t.T())
+	l1 := NewMemory(time.Hour, time.Hour)
+	l2 := NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour)
+
+	c, err := Load(NewChain(time.Minute, l1, l2))
+	t.NoError(err)
+	t.Equal(ChainDriver, c.Driver)
+
+	upper, err := Load(l1)
+	t.NoError(err)
+
+	ctx := context.Background()
+	t.NoError(c.Set(ctx, "key", "stash", Options{Expiration: time.Hour, Tags: []string{"tag"}}))
+	t.True(mr.Exists("key"))
+
+	// Remove from the upper tier, the item is back-filled
+	// from Redis with the shorter expiration.
+	t.NoError(upper.Delete(ctx, "key"))
+	var got string
+	t.NoError(c.Get(ctx, "key", &got))
+	t.Equal("stash", got)
+
+	ttl, err := upper.TTL(ctx, "key")
+	t.NoError(err)
+	t.InDelta(time.Minute, ttl, float64(time.Second))
+
+	// GetWithTTL back-fills with the remaining TTL when it
+	// is shorter than the back-fill expiration.
+	t.NoError(upper.Delete(ctx, "key"))
+	mr.SetTTL("key", time.Second*30)
+	ttl, err = c.GetWithTTL(ctx, "key", &got)
+	t.NoError(err)
+	t.Equal(time.Second*30, ttl)
+	ttl, err = upper.TTL(ctx, "key")
+	t.NoError(err)
+	t.InDelta(time.Second*30, ttl, float64(time.Second))
+
+	// Invalidate, Delete and Clear fan out to every tier.
+	t.NoError(c.Invalidate(ctx, InvalidateOptions{Tags: []string{"tag"}}))
+	t.False(mr.Exists("key"))
+	t.ErrorIs(upper.Get(ctx, "key", &got), ErrNotFound)
+
+	t.NoError(c.Set(ctx, "key", "stash", Options{}))
+	t.NoError(c.Delete(ctx, "key"))
+	t.ErrorIs(c.Get(ctx, "key", &got), ErrNotFound)
+	_, err = c.GetWithTTL(ctx, "key", &got)
+	t.ErrorIs(err, ErrNotFound)
+
+	t.NoError(c.Set(ctx, "key", "stash", Options{}))
+	t.NoError(c.Clear(ctx))
+	t.ErrorIs(c.Get(ctx, "key", &got), ErrNotFound)
+}
+
+func (t *StashTestSuite) TestChain_Memcache() {
+	srv, err := memcachetest.New()
+	t.NoError(err)
+	defer srv.Close()
+
+	mr := miniredis.RunT(t.T())
+	c, err := Load(NewChain(0,
+		NewMemcache([]string{srv.Addr()}, time.Hour),
+		NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour),
+	))
+	t.NoError(err)
+
+	ctx := context.Background()
+	t.NoError(c.Set(ctx, "key", "stash", Options{}))
+	t.NoError(c.Delete(ctx, "key"))
+	// Deleting keys missing from a tier is not an error.
+	t.NoError(c.Delete(ctx, "key"))
+
+	// Redis returns strings which are back-filled into
+	// memcache as bytes.
+	mr.Set("key", string(append([]byte{JSONSerializerID}, "\"redis\""...)))
+	var got string
+	t.NoError(c.Get(ctx, "key", &got))
+	t.Equal("redis", got)
+	t.Equal(1, srv.Len())
+}
+
+func (t *StashTestSuite) TestChainStore_Errors() {
+	failing := &mocks.StoreInterface{}
+	failing.On("Set", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(errors.New("set error"))
+	failing.On("Delete", mock.Anything, mock.Anything).Return(errors.New("delete error"))
+	failing.On("Invalidate", mock.Anything, mock.Anything).Return(errors.New("invalidate error"))
+	failing.On("Clear", mock.Anything).Return(errors.New("clear error"))
+
+	ok := &mocks.StoreInterface{}
+	ok.On("Set", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	ok.On("Delete", mock.Anything, mock.Anything).Return(nil)
+	ok.On("Invalidate", mock.Anything, mock.Anything).Return(nil)
+	ok.On("Clear", mock.Anything).Return(nil)
+
+	c := &chainStore{tiers: []store.StoreInterface{failing, ok}}
+	ctx := context.Background()
+
+	t.EqualError(c.Set(ctx, "key", []byte("value"), nil), "set error")
+	t.EqualError(c.Delete(ctx, "key"), "delete error")
+	t.EqualError(c.Invalidate(ctx, store.InvalidateOptions{}), "invalidate error")
+	t.EqualError(c.Clear(ctx), "clear error")
+
+	// Every tier is called regardless of errors.
+	ok.AssertNumberOfCalls(t.T(), "Set", 1)
+	ok.AssertNumberOfCalls(t.T(), "Delete", 1)
+	ok.AssertNumberOfCalls(t.T(), "Invalidate", 1)
+	ok.AssertNumberOfCalls(t.T(), "Clear", 1)
+}
+
+func (t *StashTestSuite) TestChain_InvalidateBackfilled() {
+	mr := miniredis.RunT(t.T())
+	l1 := NewMemory(time.Hour, time.Hour)
+	c, err := Load(NewChain(time.Minute, l1, NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour)))
+	t.NoError(err)
+	upper, err := Load(l1)
+	t.NoError(err)
+
+	ctx := context.Background()
+	t.NoError(c.Set(ctx, "key", "stash", Options{Tags: []string{"tag"}}))
+	t.NoError(upper.Clear(ctx))
+
+	var got string
+	t.NoError(c.Get(ctx, "key", &got))
+	t.NoError(upper.Get(ctx, "key", &got))
+
+	// The back-filled item has no tags in the upper tier
+	// but is still removed.
+	t.NoError(c.Invalidate(ctx, InvalidateOptions{Tags: []string{"tag"}}))
+	t.ErrorIs(upper.Get(ctx, "key", &got), ErrNotFound)
+}
+
+func (t *StashTestSuite) TestTagResolver_Providers() {
+	for name, p := range t.Providers() {
+		t.Run(name, func() {
+			c := t.LoadCache(p)
+			ctx := context.Background()
+			t.NoError(c.Clear(ctx))
+			t.NoError(c.Set(ctx, "one", 1, Options{Tags: []string{"a"}}))
+			t.NoError(c.Set(ctx, "two", 2, Options{Tags: []string{"a", "b"}}))
+
+			tr, ok := c.store.(TagResolver)
+			t.True(ok)
+			keys, err := tr.TagKeys(ctx, []string{"a", "missing"})
+			t.NoError(err)
+			t.ElementsMatch([]string{"one", "two"}, keys)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"sync"
+)
+
+// lifecycle tracks the operations in flight on a Cache so
+// Close can wait for them to finish. Caches derived with
+// WithNamespace share their parent's.
+type lifecycle struct {
+	mtx    sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+	// ctx is passed to background refreshes, it is
+	// cancelled once the cache is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// done is closed once the first call to Close has
+	// released every resource.
+	done chan struct{}
+}
+
+// newLifecycle returns a lifecycle for an open Cache.
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lifecycle{
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// acquire registers an operation as in flight, returning
+// ErrClosed if the cache has been closed. Every
+// successful call must be followed by a call to release.
+func (l *lifecycle) acquire() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	l.wg.Add(1)
+	return nil
+}
+
+// release marks an operation registered with acquire as
+// finished.
+func (l *lifecycle) release() {
+	l.wg.Done()
+}
+
+// Close stops the cache from accepting new operations,
+// waits for the operations in flight (including
+// background refreshes started by Remember) to finish and
+// releases the resources owned by the cache. The bus set
+// via WithInvalidationBus is closed, stopping its
+// subscription, followed by the Provider.
+//
+// If ctx is done before the operations have finished,
+// background refreshes are cancelled, the resources are
+// released regardless and ctx's error is returned.
+//
+// Caches derived with WithNamespace share the Provider,
+// closing any of them closes them all. Calling Close more
+// than once has no effect, every other method returns
+// ErrClosed once the cache is closed.
+func (c *Cache) Close(ctx context.Context) error {
+	l := c.life
+	l.mtx.Lock()
+	if l.closed {
+		l.mtx.Unlock()
+		select {
+		case <-l.done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	l.closed = true
+	l.mtx.Unlock()
+	defer close(l.done)
+
+	drained := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	l.cancel()
+
+	if c.bus != nil {
+		if busErr := c.bus.bus.Close(); busErr != nil && err == nil {
+			err = busErr
+		}
+	}
+	if c.provider != nil {
+		if provErr := c.provider.Close(ctx); provErr != nil && err == nil {
+			err = provErr
+		}
+	}
+
+	return err
+}
+
+// closedResults returns a result for each key with an Err
+// of ErrClosed, used by batch operations once the cache
+// is closed.
+func closedResults(keys []interface{}) Results {
+	results := make(Results, len(keys))
+	for i, key := range keys {
+		results[i] = Result{Key: key, Err: ErrClosed}
+	}
+	return results
+}
+
+// closeOnce calls a Provider's close function once,
+// returning its error to every caller so Close is
+// idempotent.
+type closeOnce struct {
+	once sync.Once
+	err  error
+}
+
+// close calls fn the first time it is called.
+func (o *closeOnce) close(fn func() error) error {
+	o.once.Do(func() {
+		o.err = fn()
+	})
+	return o.err
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"errors"
+	"github.com/lacuna-seo/stash/mocks"
+	"github.com/stretchr/testify/mock"
+	"time"
+)
+
+func (t *StashTestSuite) TestClose() {
+	bus := &fakeBus{}
+	c, err := Load(NewMemory(time.Hour, time.Millisecond), WithInvalidationBus(bus, nil))
+	t.NoError(err)
+	ns := c.WithNamespace("ns")
+
+	ctx := context.Background()
+	t.NoError(c.Set(ctx, "key", "stash", Options{}))
+	t.NoError(ns.Close(ctx))
+	t.True(bus.closed)
+
+	// Closing is idempotent.
+	t.NoError(c.Close(ctx))
+	t.NoError(ns.Close(ctx))
+
+	var got string
+	t.ErrorIs(c.Get(ctx, "key", &got), ErrClosed)
+	_, err = c.GetWithTTL(ctx, "key", &got)
+	t.ErrorIs(err, ErrClosed)
+	_, err = c.TTL(ctx, "key")
+	t.ErrorIs(err, ErrClosed)
+	_, err = c.GetWithStaleness(ctx, "key", &got)
+	t.ErrorIs(err, ErrClosed)
+	t.ErrorIs(c.Set(ctx, "key", "stash", Options{}), ErrClosed)
+	t.ErrorIs(c.SetAbsent(ctx, "key", Options{}), ErrClosed)
+	t.ErrorIs(c.Delete(ctx, "key"), ErrClosed)
+	t.ErrorIs(c.Invalidate(ctx, InvalidateOptions{Tags: []string{"tag"}}), ErrClosed)
+	t.ErrorIs(c.Clear(ctx), ErrClosed)
+	t.ErrorIs(c.Remember(ctx, "key", &got, Options{}, func(ctx context.Context) (interface{}, error) {
+		return "stash", nil
+	}), ErrClosed)
+	t.ErrorIs(c.GetMany(ctx, "key").Err(), ErrClosed)
+	t.ErrorIs(c.SetMany(ctx, Item{Key: "key", Value: "stash"}).Err(), ErrClosed)
+	t.ErrorIs(c.DeleteMany(ctx, "key").Err(), ErrClosed)
+	t.ErrorIs(ns.Get(ctx, "key", &got), ErrClosed)
+}
+
+func (t *StashTestSuite) TestClose_Drain() {
+	c, err := Load(NewMemory(time.Hour, time.Hour))
+	t.NoError(err)
+
+	ctx := context.Background()
+	started, release := make(chan struct{}), make(chan struct{})
+	go func() {
+		_ = c.Remember(ctx, "key", new(string), Options{}, func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			return "stash", nil
+		})
+	}()
+	<-started
+
+	closed := make(chan error)
+	go func() {
+		closed <- c.Close(ctx)
+	}()
+
+	select {
+	case <-closed:
+		t.Fail("Close returned before the operation finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	t.NoError(<-closed)
+	t.ErrorIs(c.Get(ctx, "key", new(string)), ErrClosed)
+}
+
+func (t *StashTestSuite) TestClose_Deadline() {
+	c, err := Load(NewMemory(time.Hour, time.Hour))
+	t.NoError(err)
+
+	ctx := context.Background()
+	o := Options{Expiration: time.Millisecond, Grace: time.Hour}
+	t.NoError(c.Set(ctx, "key", "stash", o))
+	time.Sleep(5 * time.Millisecond)
+
+	// The stale item starts a background refresh that runs
+	// until it is cancelled by Close.
+	started, cancelled := make(chan struct{}), make(chan error, 1)
+	t.NoError(c.Remember(ctx, "key", new(string), o, func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return nil, ctx.Err()
+	}))
+	<-started
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	t.ErrorIs(c.Close(timeout), context.DeadlineExceeded)
+	t.ErrorIs(<-cancelled, context.Canceled)
+}
+
+func (t *StashTestSuite) TestClose_Chain() {
+	tier := &mocks.Provider{}
+	tier.On("Validate").Return(nil)
+	tier.On("Ping").Return(nil)
+	tier.On("Store").Return(NewMemory(time.Hour, time.Hour).Store())
+	tier.On("Close", mock.Anything).Return(errors.New("close error"))
+
+	c, err := Load(NewChain(time.Minute, NewMemory(time.Hour, time.Hour), tier))
+	t.NoError(err)
+	t.EqualError(c.Close(context.Background()), "close error")
+	tier.AssertCalled(t.T(), "Close", mock.Anything)
+}
+
+// closeProvider records whether the Provider was closed.
+type closeProvider struct {
+	Provider
+	closed bool
+}
+
+func (p *closeProvider) Close(ctx context.Context) error {
+	p.closed = true
+	return p.Provider.Close(ctx)
+}
+
+func (t *StashTestSuite) TestLoad_ClosesProvider() {
+	k, err := NewKeyring("v1", map[string][]byte{"v1": keyV1})
+	t.NoError(err)
+
+	tt := map[string]struct {
+		opts   []LoadOption
+		closed bool
+	}{
+		"Loaded":      {[]LoadOption{WithEncryption(k)}, false},
+		"Compressor":  {[]LoadOption{WithCompression(nil, 0)}, true},
+		"Reserved ID": {[]LoadOption{WithSerializer(idSerializer(staleHeader))}, true},
+		"Keyring":     {[]LoadOption{WithIntegrity(nil)}, true},
+		"Subscribe":   {[]LoadOption{WithInvalidationBus(&fakeBus{subErr: errors.New("subscribe error")}, nil)}, true},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func() {
+			p := &closeProvider{Provider: NewMemory(time.Hour, time.Hour)}
+			c, err := Load(p, test.opts...)
+			t.Equal(test.closed, err != nil)
+			t.Equal(test.closed, p.closed)
+			if c != nil {
+				t.NoError(c.Close(context.Background()))
+				t.True(p.closed)
+			}
+		})
+	}
+}
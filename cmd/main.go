@@ -14,6 +14,7 @@ func main() {
 	memory := flag.Bool("memory", false, "Pass to use the Memory example")
 	redis := flag.Bool("redis", false, "Pass to use the Redis example")
 	memcache := flag.Bool("memcache", false, "Pass to use the Memcache example")
+	chain := flag.Bool("chain", false, "Pass to use the Chain (Memory & Redis) example")
 
 	flag.Parse()
 
@@ -32,5 +33,10 @@ func main() {
 		return
 	}
 
-	log.Fatalln("No provider found use --memory, --redis or --memcache")
+	if *chain {
+		examples.Chain()
+		return
+	}
+
+	log.Fatalln("No provider found use --memory, --redis, --memcache or --chain")
 }
@@ -0,0 +1,217 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/golang/snappy"
+	"io"
+	"sync/atomic"
+)
+
+// Compressor defines the methods for compressing values
+// after they have been serialized, and decompressing
+// values before they are unmarshalled.
+type Compressor interface {
+	// ID returns the prefix byte written before every
+	// compressed value. It must be unique between
+	// compressors and must not clash with the Serializer
+	// ID. IDs from 0x00 to 0x1f are reserved by stash, see
+	// Serializer, custom compressors must use an ID above
+	// 0x1f. Load returns an error if the ID is reserved or
+	// clashes.
+	ID() byte
+
+	// Compress returns the compressed form of data.
+	Compress(data []byte) ([]byte, error)
+
+	// Decompress returns the original form of data.
+	Decompress(data []byte) ([]byte, error)
+}
+
+const (
+	// GzipCompressorID is the prefix byte for values
+	// compressed with gzip.
+	GzipCompressorID byte = 0x10
+	// SnappyCompressorID is the prefix byte for values
+	// compressed with snappy.
+	SnappyCompressorID byte = 0x11
+)
+
+var (
+	// GzipCompressor compresses values with gzip, it has a
+	// better ratio than snappy at the cost of speed.
+	GzipCompressor Compressor = gzipCompressor{}
+	// SnappyCompressor compresses values with snappy, it
+	// is fast with a reasonable ratio.
+	SnappyCompressor Compressor = snappyCompressor{}
+	// compressors are the built-in compressors keyed by
+	// their ID, used for reading entries compressed with
+	// a different compressor.
+	compressors = map[byte]Compressor{
+		GzipCompressorID:   GzipCompressor,
+		SnappyCompressorID: SnappyCompressor,
+	}
+)
+
+// CompressionStats defines the statistics for values
+// compressed by a Cache.
+type CompressionStats struct {
+	// Compressed is the amount of values that have been
+	// compressed.
+	Compressed uint64
+	// Skipped is the amount of values that were below the
+	// threshold or did not shrink when compressed.
+	Skipped uint64
+	// BytesIn is the total size of values before they
+	// were compressed.
+	BytesIn uint64
+	// BytesOut is the total size of values after they
+	// were compressed.
+	BytesOut uint64
+}
+
+// Ratio returns the compression ratio of BytesOut to
+// BytesIn, a lower value means better compression.
+// Returns 0 if nothing has been compressed.
+func (s CompressionStats) Ratio() float64 {
+	if s.BytesIn == 0 {
+		return 0
+	}
+	return float64(s.BytesOut) / float64(s.BytesIn)
+}
+
+// compression defines the compression configuration and
+// statistics for a Cache.
+type compression struct {
+	// Counters are kept at the top of the struct so they
+	// are 64 bit aligned for atomic operations.
+	compressed uint64
+	skipped    uint64
+	bytesIn    uint64
+	bytesOut   uint64
+	compressor Compressor
+	threshold  int
+}
+
+// WithCompression compresses serialized values that are
+// equal to or larger than threshold bytes with the given
+// Compressor. Compressed values are prefixed so Get
+// decompresses them transparently, and values that are
+// not compressed remain readable. Load returns an error
+// if the Compressor is nil, or if a custom Compressor's ID
+// is reserved or clashes with the Serializer's.
+func WithCompression(c Compressor, threshold int) LoadOption {
+	return func(cache *Cache) {
+		cache.compression = &compression{
+			compressor: c,
+			threshold:  threshold,
+		}
+	}
+}
+
+// compress compresses data if it meets the threshold and
+// shrinks when compressed, otherwise data is returned
+// untouched.
+func (c *compression) compress(data []byte) ([]byte, error) {
+	if len(data) < c.threshold {
+		atomic.AddUint64(&c.skipped, 1)
+		return data, nil
+	}
+	out, err := c.compressor.Compress(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(out)+1 >= len(data) {
+		atomic.AddUint64(&c.skipped, 1)
+		return data, nil
+	}
+	atomic.AddUint64(&c.compressed, 1)
+	atomic.AddUint64(&c.bytesIn, uint64(len(data)))
+	atomic.AddUint64(&c.bytesOut, uint64(len(out)+1))
+	buf := make([]byte, 0, len(out)+1)
+	buf = append(buf, c.compressor.ID())
+	return append(buf, out...), nil
+}
+
+// stats returns a snapshot of the compression statistics.
+func (c *compression) stats() CompressionStats {
+	return CompressionStats{
+		Compressed: atomic.LoadUint64(&c.compressed),
+		Skipped:    atomic.LoadUint64(&c.skipped),
+		BytesIn:    atomic.LoadUint64(&c.bytesIn),
+		BytesOut:   atomic.LoadUint64(&c.bytesOut),
+	}
+}
+
+// decompress checks the prefix of data and decompresses
+// it with the matching Compressor, the current Compressor
+// is checked before the built-in ones. Data without a
+// compression prefix is returned untouched.
+func decompress(c Compressor, data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	id := data[0]
+	if c != nil && c.ID() == id {
+		return c.Decompress(data[1:])
+	}
+	if comp, ok := compressors[id]; ok {
+		return comp.Decompress(data[1:])
+	}
+	return data, nil
+}
+
+// gzipCompressor implements Compressor with gzip.
+type gzipCompressor struct{}
+
+// ID satisfies the Compressor interface.
+func (gzipCompressor) ID() byte {
+	return GzipCompressorID
+}
+
+// Compress satisfies the Compressor interface.
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	buf := bytes.Buffer{}
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress satisfies the Compressor interface.
+func (gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// snappyCompressor implements Compressor with snappy.
+type snappyCompressor struct{}
+
+// ID satisfies the Compressor interface.
+func (snappyCompressor) ID() byte {
+	return SnappyCompressorID
+}
+
+// Compress satisfies the Compressor interface.
+func (snappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+// Decompress satisfies the Compressor interface.
+func (snappyCompressor) Decompress(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
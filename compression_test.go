@@ -0,0 +1,154 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// errorCompressor is a Compressor that always errors.
+type errorCompressor struct{}
+
+func (errorCompressor) ID() byte { return 0x20 }
+
+func (errorCompressor) Compress(data []byte) ([]byte, error) {
+	return nil, errors.New("compress error")
+}
+
+func (errorCompressor) Decompress(data []byte) ([]byte, error) {
+	return nil, errors.New("decompress error")
+}
+
+func (t *StashTestSuite) TestCompressor_RoundTrip() {
+	want := []byte(strings.Repeat("stash", 100))
+
+	tt := map[string]Compressor{
+		"Gzip":   GzipCompressor,
+		"Snappy": SnappyCompressor,
+	}
+
+	for name, comp := range tt {
+		t.Run(name, func() {
+			c := compression{compressor: comp, threshold: 10}
+			buf, err := c.compress(want)
+			t.NoError(err)
+			t.Equal(comp.ID(), buf[0])
+			t.Less(len(buf), len(want))
+
+			got, err := decompress(nil, buf)
+			t.NoError(err)
+			t.Equal(want, got)
+		})
+	}
+}
+
+func (t *StashTestSuite) TestCompression_Compress() {
+	tt := map[string]struct {
+		comp      Compressor
+		threshold int
+		input     []byte
+		want      CompressionStats
+		err       interface{}
+	}{
+		"Below Threshold": {
+			GzipCompressor,
+			100,
+			[]byte("stash"),
+			CompressionStats{Skipped: 1},
+			nil,
+		},
+		"No Gain": {
+			GzipCompressor,
+			0,
+			[]byte("stash"),
+			CompressionStats{Skipped: 1},
+			nil,
+		},
+		"Compressed": {
+			SnappyCompressor,
+			0,
+			[]byte(strings.Repeat("a", 100)),
+			CompressionStats{Compressed: 1, BytesIn: 100, BytesOut: 10},
+			nil,
+		},
+		"Error": {
+			errorCompressor{},
+			0,
+			[]byte("stash"),
+			CompressionStats{},
+			"compress error",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func() {
+			c := compression{compressor: test.comp, threshold: test.threshold}
+			_, err := c.compress(test.input)
+			if err != nil {
+				t.Contains(err.Error(), test.err)
+				return
+			}
+			t.Equal(test.want, c.stats())
+		})
+	}
+}
+
+func (t *StashTestSuite) TestDecompress() {
+	got, err := decompress(nil, nil)
+	t.NoError(err)
+	t.Nil(got)
+
+	got, err = decompress(nil, []byte("\"stash\""))
+	t.NoError(err)
+	t.Equal([]byte("\"stash\""), got)
+
+	_, err = decompress(errorCompressor{}, []byte{0x20, 0x01})
+	t.EqualError(err, "decompress error")
+
+	_, err = decompress(nil, []byte{GzipCompressorID, 0x01})
+	t.Error(err)
+}
+
+func (t *StashTestSuite) TestCompressionStats_Ratio() {
+	t.Equal(float64(0), CompressionStats{}.Ratio())
+	t.Equal(0.25, CompressionStats{BytesIn: 100, BytesOut: 25}.Ratio())
+}
+
+func (t *StashTestSuite) TestWithCompression() {
+	p := NewMemory(time.Hour, time.Hour)
+	c, err := Load(p, WithCompression(GzipCompressor, 64))
+	t.NoError(err)
+
+	ctx := context.Background()
+	want := strings.Repeat("stash", 100)
+	t.NoError(c.Set(ctx, "large", want, Options{}))
+	t.NoError(c.Set(ctx, "small", "stash", Options{}))
+
+	var got string
+	t.NoError(c.Get(ctx, "large", &got))
+	t.Equal(want, got)
+	t.NoError(c.Get(ctx, "small", &got))
+	t.Equal("stash", got)
+
+	stats := c.CompressionStats()
+	t.Equal(uint64(1), stats.Compressed)
+	t.Equal(uint64(1), stats.Skipped)
+	t.Less(stats.Ratio(), 0.5)
+
+	// Caches without compression can read compressed items.
+	plain, err := Load(p)
+	t.NoError(err)
+	t.Equal(CompressionStats{}, plain.CompressionStats())
+	t.NoError(plain.Get(ctx, "large", &got))
+	t.Equal(want, got)
+}
+
+func (t *StashTestSuite) TestWithCompression_Nil() {
+	_, err := Load(NewMemory(time.Hour, time.Hour), WithCompression(nil, 0))
+	t.EqualError(err, "stash: nil compressor")
+}
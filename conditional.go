@@ -0,0 +1,100 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"errors"
+	"github.com/eko/gocache/v2/store"
+)
+
+// ConditionalSetter is implemented by stores that can
+// atomically store an item only if the key does not exist
+// (Add) or only if it does (Replace), storing its tags the
+// same way as Set. Add returns ErrKeyExists and Replace
+// returns ErrNotFound when the item is not stored.
+type ConditionalSetter interface {
+	Add(ctx context.Context, key string, value []byte, options *store.Options) error
+	Replace(ctx context.Context, key string, value []byte, options *store.Options) error
+}
+
+// Add stores an item only if the key does not already
+// exist, returning ErrKeyExists if it does, so the first
+// writer wins. Keys marked as absent with SetAbsent exist.
+// Values are marshalled and tags are stored as with Set.
+//
+// Redis uses SET NX, Memcache its add command and the
+// memory store checks and sets under a single lock. Stores
+// that do not implement ConditionalSetter check the key
+// exists before setting it, which is only atomic between
+// calls through the same Cache.
+func (c *Cache) Add(ctx context.Context, key interface{}, value interface{}, options Options) error {
+	return c.setIf(ctx, OperationAdd, key, value, options)
+}
+
+// Replace stores an item only if the key already exists,
+// returning ErrNotFound if it does not. Values are
+// marshalled and tags are stored as with Set.
+//
+// Redis uses SET XX, Memcache its replace command and the
+// memory store checks and sets under a single lock, see
+// Add for other stores.
+func (c *Cache) Replace(ctx context.Context, key interface{}, value interface{}, options Options) error {
+	return c.setIf(ctx, OperationReplace, key, value, options)
+}
+
+// setIf marshals and writes the value for Add and
+// Replace, reporting whether the key existed.
+func (c *Cache) setIf(ctx context.Context, op string, key interface{}, value interface{}, options Options) error {
+	if err := c.life.acquire(); err != nil {
+		return err
+	}
+	defer c.life.release()
+
+	ctx, start := c.start(ctx, op)
+	marshal, err := c.marshal(value)
+	if err == nil {
+		err = c.write(ctx, op, key, marshal, options)
+	}
+
+	e := Event{Operation: op, Keys: []string{c.key(key)}, Size: len(marshal), Err: err}
+	switch {
+	case errors.Is(err, ErrKeyExists):
+		e.Hits, e.Err = 1, nil
+	case errors.Is(err, ErrNotFound):
+		e.Misses, e.Err = 1, nil
+	case err == nil && op == OperationAdd:
+		e.Misses = 1
+	case err == nil:
+		e.Hits = 1
+	}
+	c.observe(ctx, start, e)
+
+	return err
+}
+
+// setIf stores the value in the store if the key exists
+// (replace) or does not exist (add). Stores that do not
+// implement ConditionalSetter are checked first.
+func setIf(ctx context.Context, s store.StoreInterface, key string, value []byte, options *store.Options, replace bool) error {
+	if cs, ok := s.(ConditionalSetter); ok {
+		if replace {
+			return cs.Replace(ctx, key, value, options)
+		}
+		return cs.Add(ctx, key, value, options)
+	}
+
+	found, err := exists(ctx, s, []string{key})
+	if err != nil {
+		return err
+	}
+	switch {
+	case replace && !found[0]:
+		return ErrNotFound
+	case !replace && found[0]:
+		return ErrKeyExists
+	}
+	return s.Set(ctx, key, value, options)
+}
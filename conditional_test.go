@@ -0,0 +1,118 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func (t *StashTestSuite) TestAddReplace() {
+	r := &recorder{}
+	c := t.LoadCache(NewMemory(time.Hour, time.Hour), WithInstrumentation(r))
+	ctx := context.Background()
+	options := Options{Expiration: time.Hour, Tags: []string{"tag"}}
+
+	err := c.Replace(ctx, "key", "replaced", options)
+	t.ErrorIs(err, ErrNotFound)
+	e := r.last()
+	t.Equal(OperationReplace, e.Operation)
+	t.Equal(1, e.Misses)
+	t.NoError(e.Err)
+
+	t.NoError(c.Add(ctx, "key", "added", options))
+	t.Equal(1, r.last().Misses)
+
+	err = c.Add(ctx, "key", "again", options)
+	t.ErrorIs(err, ErrKeyExists)
+	e = r.last()
+	t.Equal(OperationAdd, e.Operation)
+	t.Equal(1, e.Hits)
+	t.NoError(e.Err)
+
+	var got string
+	t.NoError(c.Get(ctx, "key", &got))
+	t.Equal("added", got)
+
+	t.NoError(c.Replace(ctx, "key", "replaced", options))
+	t.Equal(1, r.last().Hits)
+	t.NoError(c.Get(ctx, "key", &got))
+	t.Equal("replaced", got)
+
+	t.NoError(c.Invalidate(ctx, InvalidateOptions{Tags: []string{"tag"}}))
+	t.ErrorIs(c.Get(ctx, "key", &got), ErrNotFound)
+}
+
+func (t *StashTestSuite) TestAdd_Concurrent() {
+	mr := miniredis.RunT(t.T())
+
+	// Separate caches share the same Redis, so only SET NX
+	// decides the winner.
+	var stored int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		c, err := Load(NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour))
+		t.NoError(err)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if c.Add(context.Background(), "key", i, Options{}) == nil {
+				atomic.AddInt32(&stored, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	t.Equal(int32(1), stored)
+}
+
+func (t *StashTestSuite) TestAddReplace_Chain() {
+	mr := miniredis.RunT(t.T())
+	l1 := NewMemory(time.Hour, time.Hour)
+	c, err := Load(NewChain(time.Minute, l1, NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour)))
+	t.NoError(err)
+	upper, err := Load(l1)
+	t.NoError(err)
+
+	ctx := context.Background()
+	t.NoError(upper.Set(ctx, "upper", "stash", Options{}))
+	t.NoError(mr.Set("lower", "stash"))
+
+	// The last tier decides whether the item is stored.
+	t.NoError(c.Add(ctx, "upper", "added", Options{}))
+	t.ErrorIs(c.Add(ctx, "lower", "added", Options{}), ErrKeyExists)
+	t.ErrorIs(c.Replace(ctx, "missing", "replaced", Options{}), ErrNotFound)
+
+	// Stored items are set in the upper tiers.
+	t.NoError(c.Replace(ctx, "lower", "replaced", Options{}))
+	var got string
+	t.NoError(upper.Get(ctx, "lower", &got))
+	t.Equal("replaced", got)
+}
+
+func (t *StashTestSuite) TestAddReplace_Middleware() {
+	var ops []string
+	mw := func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) error {
+			ops = append(ops, call.Operation)
+			return next(ctx, call)
+		}
+	}
+	c, err := Load(NewMemory(time.Hour, time.Hour), WithMiddleware(mw))
+	t.NoError(err)
+
+	ctx := context.Background()
+	t.NoError(c.Add(ctx, "key", "added", Options{}))
+	t.ErrorIs(c.Add(ctx, "key", "added", Options{}), ErrKeyExists)
+	t.NoError(c.Replace(ctx, "key", "replaced", Options{}))
+	t.Equal([]string{OperationAdd, OperationAdd, OperationReplace}, ops)
+
+	t.NoError(c.Close(ctx))
+	t.ErrorIs(c.Add(ctx, "key", "added", Options{}), ErrClosed)
+	t.ErrorIs(c.Replace(ctx, "key", "replaced", Options{}), ErrClosed)
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"errors"
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// ErrNotFound is returned by Get when the key does not
+	// exist in the store, regardless of the Driver used.
+	// Use errors.Is to check for a cache miss.
+	ErrNotFound = errors.New("stash: key not found")
+	// ErrEmptyValue is returned by Get when the value
+	// retrieved from the store contains no data.
+	ErrEmptyValue = errors.New("stash: empty value")
+	// ErrAbsent is returned by Get when the key has been
+	// marked as known to be absent with SetAbsent. It is
+	// not a cache miss, the source does not need to be
+	// consulted.
+	ErrAbsent = errors.New("stash: key known to be absent")
+	// ErrKeyExists is returned by Add when the key is
+	// already stored.
+	ErrKeyExists = errors.New("stash: key already exists")
+	// ErrClosed is returned by every operation once the
+	// Cache has been closed.
+	ErrClosed = errors.New("stash: cache closed")
+	// ErrNamespaceClear is returned by Clear when the
+	// Cache has a namespace and the store implements
+	// neither PrefixClearer nor GenerationCounter.
+	ErrNamespaceClear = errors.New("stash: store cannot clear a namespace")
+)
+
+// goCacheNotFound is the error message returned by the
+// gocache memory store when a key does not exist.
+const goCacheNotFound = "Value not found in GoCache store"
+
+// notFound converts the driver specific cache miss errors
+// (go-cache, redis.Nil and memcache.ErrCacheMiss) to
+// ErrNotFound. Any other error is returned untouched.
+func notFound(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, redis.Nil) || errors.Is(err, memcache.ErrCacheMiss) || err.Error() == goCacheNotFound {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/go-redis/redis/v8"
+)
+
+func (t *StashTestSuite) TestNotFound() {
+	tt := map[string]struct {
+		input error
+		want  error
+	}{
+		"Nil": {
+			nil,
+			nil,
+		},
+		"Memory": {
+			errors.New(goCacheNotFound),
+			ErrNotFound,
+		},
+		"Redis": {
+			redis.Nil,
+			ErrNotFound,
+		},
+		"Memcache": {
+			memcache.ErrCacheMiss,
+			ErrNotFound,
+		},
+		"Wrapped": {
+			fmt.Errorf("wrapped: %w", redis.Nil),
+			ErrNotFound,
+		},
+		"Other": {
+			errors.New("error"),
+			errors.New("error"),
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func() {
+			t.Equal(test.want, notFound(test.input))
+		})
+	}
+}
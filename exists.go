@@ -0,0 +1,110 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"errors"
+	"github.com/eko/gocache/v2/store"
+)
+
+// ExistenceChecker is implemented by stores that can
+// check whether keys exist without retrieving their
+// values. The presence returned is in the same order as
+// the keys passed.
+type ExistenceChecker interface {
+	Exists(ctx context.Context, keys []string) ([]bool, error)
+}
+
+// Exists reports whether each key is stored, in the same
+// order as the keys passed, without unmarshalling the
+// values. Stores that implement ExistenceChecker (Redis
+// and memory) check every key without transferring the
+// values, others retrieve them (in a single round trip
+// for stores that implement BatchGetter, such as
+// Memcache).
+//
+// Keys marked as absent with SetAbsent and items within
+// their Grace period exist.
+func (c *Cache) Exists(ctx context.Context, keys ...interface{}) ([]bool, error) {
+	if err := c.life.acquire(); err != nil {
+		return nil, err
+	}
+	defer c.life.release()
+
+	strKeys := make([]string, len(keys))
+	for i, key := range keys {
+		strKeys[i] = c.key(key)
+	}
+
+	ctx, start := c.start(ctx, OperationExists)
+	found, err := c.exists(ctx, strKeys)
+	e := Event{Operation: OperationExists, Keys: strKeys, Err: err}
+	for _, ok := range found {
+		if ok {
+			e.Hits++
+		} else {
+			e.Misses++
+		}
+	}
+	c.observe(ctx, start, e)
+
+	return found, err
+}
+
+// exists checks the keys against the store, one key at a
+// time through the middleware chain if there is one.
+func (c *Cache) exists(ctx context.Context, keys []string) ([]bool, error) {
+	if len(c.middleware) == 0 {
+		mapped, err := c.storeKeys(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+		return exists(ctx, c.store, mapped)
+	}
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		err := c.handle(ctx, &Call{Operation: OperationExists, Key: key})
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found[i] = true
+	}
+	return found, nil
+}
+
+// exists checks the keys against the store using the
+// cheapest method it supports.
+func exists(ctx context.Context, s store.StoreInterface, keys []string) ([]bool, error) {
+	if ec, ok := s.(ExistenceChecker); ok {
+		return ec.Exists(ctx, keys)
+	}
+
+	found := make([]bool, len(keys))
+	if bg, ok := s.(BatchGetter); ok {
+		_, errs := bg.GetMany(ctx, keys)
+		for i, err := range errs {
+			err = notFound(err)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+			found[i] = err == nil
+		}
+		return found, nil
+	}
+
+	for i, key := range keys {
+		_, err := s.Get(ctx, key)
+		err = notFound(err)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		found[i] = err == nil
+	}
+	return found, nil
+}
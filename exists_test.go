@@ -0,0 +1,87 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+func (t *StashTestSuite) TestExists() {
+	r := &recorder{}
+	c := t.LoadCache(NewMemory(time.Hour, time.Hour), WithInstrumentation(r))
+	ctx := context.Background()
+
+	t.NoError(c.Set(ctx, "key", "stash", Options{Expiration: time.Hour}))
+	t.NoError(c.SetAbsent(ctx, "absent", Options{Expiration: time.Hour}))
+
+	found, err := c.Exists(ctx, "key", "missing", "absent")
+	t.NoError(err)
+	t.Equal([]bool{true, false, true}, found)
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationExists, Hits: 2, Misses: 1}, r.last())
+
+	found, err = c.Exists(ctx)
+	t.NoError(err)
+	t.Empty(found)
+}
+
+func (t *StashTestSuite) TestExists_Chain() {
+	mr := miniredis.RunT(t.T())
+	l1 := NewMemory(time.Hour, time.Hour)
+	c, err := Load(NewChain(time.Minute, l1, NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour)))
+	t.NoError(err)
+	upper, err := Load(l1)
+	t.NoError(err)
+
+	ctx := context.Background()
+	t.NoError(upper.Set(ctx, "upper", "stash", Options{}))
+	t.NoError(mr.Set("lower", "stash"))
+
+	found, err := c.Exists(ctx, "lower", "missing", "upper")
+	t.NoError(err)
+	t.Equal([]bool{true, false, true}, found)
+
+	// Nothing is back-filled into the upper tier.
+	found, err = upper.Exists(ctx, "lower")
+	t.NoError(err)
+	t.Equal([]bool{false}, found)
+}
+
+func (t *StashTestSuite) TestExists_Middleware() {
+	var ops []string
+	mw := func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) error {
+			ops = append(ops, call.Operation)
+			return next(ctx, call)
+		}
+	}
+	c, err := Load(NewMemory(time.Hour, time.Hour), WithMiddleware(mw))
+	t.NoError(err)
+
+	ctx := context.Background()
+	t.NoError(c.Set(ctx, "key", "stash", Options{}))
+	ops = nil
+
+	found, err := c.Exists(ctx, "key", "missing")
+	t.NoError(err)
+	t.Equal([]bool{true, false}, found)
+	t.Equal([]string{OperationExists, OperationExists}, ops)
+}
+
+func (t *StashTestSuite) TestExists_Error() {
+	mr := miniredis.RunT(t.T())
+	c, err := Load(NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour))
+	t.NoError(err)
+	mr.Close()
+
+	_, err = c.Exists(context.Background(), "key")
+	t.Error(err)
+
+	t.NoError(c.Close(context.Background()))
+	_, err = c.Exists(context.Background(), "key")
+	t.ErrorIs(err, ErrClosed)
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// OperationGet is the operation reported by Get.
+	OperationGet = "get"
+	// OperationGetWithTTL is the operation reported by
+	// GetWithTTL.
+	OperationGetWithTTL = "get_with_ttl"
+	// OperationTTL is the operation reported by TTL.
+	OperationTTL = "ttl"
+	// OperationSet is the operation reported by Set.
+	OperationSet = "set"
+	// OperationDelete is the operation reported by Delete.
+	OperationDelete = "delete"
+	// OperationGetMany is the operation reported by
+	// GetMany.
+	OperationGetMany = "get_many"
+	// OperationSetMany is the operation reported by
+	// SetMany.
+	OperationSetMany = "set_many"
+	// OperationDeleteMany is the operation reported by
+	// DeleteMany.
+	OperationDeleteMany = "delete_many"
+	// OperationInvalidate is the operation reported by
+	// Invalidate.
+	OperationInvalidate = "invalidate"
+	// OperationClear is the operation reported by Clear.
+	OperationClear = "clear"
+	// OperationRemember is the operation reported by
+	// Remember.
+	OperationRemember = "remember"
+	// OperationSetAbsent is the operation reported by
+	// SetAbsent.
+	OperationSetAbsent = "set_absent"
+	// OperationExists is the operation reported by Exists.
+	OperationExists = "exists"
+	// OperationAdd is the operation reported by Add.
+	OperationAdd = "add"
+	// OperationReplace is the operation reported by
+	// Replace.
+	OperationReplace = "replace"
+)
+
+// Event defines the outcome of a single Cache method
+// call, passed to the Instrumentation set on the Cache.
+type Event struct {
+	// Driver is the Driver of the Cache.
+	Driver string
+	// Operation is the method called, such as
+	// OperationGet.
+	Operation string
+	// Keys are the keys affected by the operation in the
+	// form used within the store, they are empty for
+	// Invalidate and Clear.
+	Keys []string
+	// Hits is the amount of keys found for lookups
+	// (Get, GetWithTTL, TTL, GetMany, Exists and Remember),
+	// including keys known to be absent. For Add and
+	// Replace it is 1 if the key existed.
+	Hits int
+	// Misses is the amount of keys not found for
+	// lookups, a miss is not an error. For Add and Replace
+	// it is 1 if the key did not exist.
+	Misses int
+	// Err is the error returned by the operation, for
+	// batch operations it is the first error within the
+	// Results. ErrNotFound is reported as a miss.
+	Err error
+	// Duration is the time taken by the operation.
+	Duration time.Duration
+	// Size is the amount of bytes read from or written
+	// to the store, after serialization and compression.
+	Size int
+}
+
+// Instrumentation defines the hook called by the Cache
+// after every operation, it can be used to record metrics
+// such as hit ratios and latencies. Implementations must
+// be safe for concurrent use and should not block.
+type Instrumentation interface {
+	Observe(ctx context.Context, e Event)
+}
+
+// OperationStarter is implemented by Instrumentation that
+// needs to be notified before an operation starts, such
+// as tracers. The context returned is passed to the store
+// and to Observe once the operation has finished.
+type OperationStarter interface {
+	Start(ctx context.Context, operation string) context.Context
+}
+
+// WithInstrumentation reports every operation performed
+// through the Cache to i. It can be passed multiple times,
+// operations are started in the order passed and observed
+// in reverse.
+func WithInstrumentation(i Instrumentation) LoadOption {
+	return func(c *Cache) {
+		c.instrumentation = append(c.instrumentation, i)
+	}
+}
+
+// start notifies any OperationStarter that the operation
+// is starting, returning the context to use for it and
+// the start time.
+func (c *Cache) start(ctx context.Context, op string) (context.Context, time.Time) {
+	for _, i := range c.instrumentation {
+		if s, ok := i.(OperationStarter); ok {
+			ctx = s.Start(ctx, op)
+		}
+	}
+	return ctx, time.Now()
+}
+
+// observe completes the event with the Cache's Driver and
+// the duration since start, and passes it to each
+// Instrumentation in reverse order, so nested starters
+// finish before their parents.
+func (c *Cache) observe(ctx context.Context, start time.Time, e Event) {
+	if len(c.instrumentation) == 0 {
+		return
+	}
+	e.Driver = c.Driver
+	e.Duration = time.Since(start)
+	for i := len(c.instrumentation) - 1; i >= 0; i-- {
+		c.instrumentation[i].Observe(ctx, e)
+	}
+}
+
+// observeLookup reports a single key lookup, ErrNotFound
+// is counted as a miss and ErrAbsent as a hit rather than
+// an error.
+func (c *Cache) observeLookup(ctx context.Context, start time.Time, op, key string, size int, err error) {
+	e := Event{Operation: op, Keys: []string{key}, Size: size}
+	switch {
+	case err == nil, errors.Is(err, ErrAbsent):
+		e.Hits = 1
+	case errors.Is(err, ErrNotFound):
+		e.Misses = 1
+	default:
+		e.Err = err
+	}
+	c.observe(ctx, start, e)
+}
+
+// observeResults reports a batch operation, counting the
+// hits and misses for GetMany.
+func (c *Cache) observeResults(ctx context.Context, start time.Time, op string, keys []string, size int, results Results) {
+	e := Event{Operation: op, Keys: keys, Size: size, Err: results.Err()}
+	if op == OperationGetMany {
+		for _, result := range results {
+			switch {
+			case result.Err == nil, errors.Is(result.Err, ErrAbsent):
+				e.Hits++
+			case errors.Is(result.Err, ErrNotFound):
+				e.Misses++
+			}
+		}
+	}
+	c.observe(ctx, start, e)
+}
+
+// payloadSize returns the amount of bytes in a value
+// returned by the store.
+func payloadSize(result interface{}) int {
+	switch r := result.(type) {
+	case []byte:
+		return len(r)
+	case string:
+		return len(r)
+	}
+	return 0
+}
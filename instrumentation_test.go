@@ -0,0 +1,143 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type recorder struct {
+	mtx    sync.Mutex
+	events []Event
+}
+
+func (r *recorder) Observe(_ context.Context, e Event) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *recorder) last() Event {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	e := r.events[len(r.events)-1]
+	e.Duration = 0
+	e.Keys = nil
+	return e
+}
+
+func (t *StashTestSuite) TestCache_WithInstrumentation() {
+	r := &recorder{}
+	c, err := Load(NewMemory(time.Hour, time.Hour), WithInstrumentation(r))
+	t.NoError(err)
+	ctx := context.Background()
+	var got string
+
+	t.NoError(c.Set(ctx, "key", "value", Options{Tags: []string{"tag"}}))
+	size := r.last().Size
+	t.Greater(size, 0)
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationSet, Size: size}, r.last())
+
+	t.NoError(c.Get(ctx, "key", &got))
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationGet, Hits: 1, Size: size}, r.last())
+
+	t.ErrorIs(c.Get(ctx, "missing", &got), ErrNotFound)
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationGet, Misses: 1}, r.last())
+
+	_, err = c.GetWithTTL(ctx, "key", &got)
+	t.NoError(err)
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationGetWithTTL, Hits: 1, Size: size}, r.last())
+
+	_, err = c.TTL(ctx, "missing")
+	t.ErrorIs(err, ErrNotFound)
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationTTL, Misses: 1}, r.last())
+
+	c.GetMany(ctx, "key", "missing")
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationGetMany, Hits: 1, Misses: 1, Size: size}, r.last())
+
+	c.SetMany(ctx, Item{Key: "a", Value: "value"}, Item{Key: "b", Value: "value"})
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationSetMany, Size: size * 2}, r.last())
+
+	c.DeleteMany(ctx, "a", "b")
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationDeleteMany}, r.last())
+
+	t.NoError(c.Delete(ctx, "key"))
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationDelete}, r.last())
+
+	t.NoError(c.Invalidate(ctx, InvalidateOptions{Tags: []string{"tag"}}))
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationInvalidate}, r.last())
+
+	t.NoError(c.Clear(ctx))
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationClear}, r.last())
+
+	loader := func(ctx context.Context) (interface{}, error) {
+		return "value", nil
+	}
+	t.NoError(c.Remember(ctx, "remember", &got, Options{}, loader))
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationRemember, Misses: 1, Size: size}, r.last())
+	t.NoError(c.Remember(ctx, "remember", &got, Options{}, loader))
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationRemember, Hits: 1, Size: size}, r.last())
+
+	loaderErr := errors.New("loader error")
+	err = c.Remember(ctx, "error", &got, Options{}, func(ctx context.Context) (interface{}, error) {
+		return nil, loaderErr
+	})
+	t.ErrorIs(err, loaderErr)
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationRemember, Misses: 1, Err: loaderErr}, r.last())
+
+	t.Error(c.Set(ctx, "key", make(chan int), Options{}))
+	t.Equal(OperationSet, r.last().Operation)
+	t.Error(r.last().Err)
+
+	// Namespaced caches report to the same instrumentation.
+	t.NoError(c.WithNamespace("ns").Delete(ctx, "key"))
+	t.Equal(Event{Driver: MemoryDriver, Operation: OperationDelete}, r.last())
+}
+
+type ctxKey string
+
+type starter struct {
+	name  string
+	calls *[]string
+}
+
+func (s starter) Start(ctx context.Context, op string) context.Context {
+	*s.calls = append(*s.calls, "start "+s.name+" "+op)
+	return context.WithValue(ctx, ctxKey(s.name), true)
+}
+
+func (s starter) Observe(ctx context.Context, e Event) {
+	*s.calls = append(*s.calls, "observe "+s.name+" "+e.Operation)
+	if ctx.Value(ctxKey(s.name)) == nil {
+		*s.calls = append(*s.calls, "missing context")
+	}
+}
+
+func (t *StashTestSuite) TestCache_OperationStarter() {
+	var calls []string
+	r := &recorder{}
+	c, err := Load(NewMemory(time.Hour, time.Hour),
+		WithInstrumentation(starter{name: "a", calls: &calls}),
+		WithInstrumentation(starter{name: "b", calls: &calls}),
+		WithInstrumentation(r),
+	)
+	t.NoError(err)
+
+	var got string
+	t.ErrorIs(c.WithNamespace("ns").Get(context.Background(), "key", &got), ErrNotFound)
+	t.Equal([]string{
+		"start a get",
+		"start b get",
+		"observe b get",
+		"observe a get",
+	}, calls)
+	t.Equal([]string{"ns:key"}, r.events[0].Keys)
+
+	c.DeleteMany(context.Background(), "a", "b")
+	t.Equal([]string{"a", "b"}, r.events[1].Keys)
+}
@@ -0,0 +1,337 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package memcachetest provides an in-process memcached
+// server speaking the text protocol, for use in tests
+// that need a Memcache store without a running daemon.
+package memcachetest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// relativeExpiryLimit is the largest expiration (in
+// seconds) memcached treats as relative, anything larger
+// is a unix timestamp.
+const relativeExpiryLimit = 60 * 60 * 24 * 30
+
+// Server defines an in-process memcached server.
+type Server struct {
+	// Now returns the current time used for expiration,
+	// it defaults to time.Now and can be replaced to
+	// control time within tests.
+	Now      func() time.Time
+	listener net.Listener
+	mtx      sync.Mutex
+	items    map[string]item
+	cas      uint64
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+}
+
+// item defines a value stored within the Server.
+type item struct {
+	value  []byte
+	flags  uint32
+	expiry time.Time
+	cas    uint64
+}
+
+// New starts a new Server listening on a random local
+// port. Call Close to stop it.
+func New() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Now:      time.Now,
+		listener: l,
+		items:    make(map[string]item),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the Server is listening on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the Server and closes any open
+// connections.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.mtx.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mtx.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// Len returns the amount of unexpired items stored.
+func (s *Server) Len() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	n := 0
+	for k := range s.items {
+		if _, ok := s.get(k); ok {
+			n++
+		}
+	}
+	return n
+}
+
+// serve accepts connections until the listener is closed.
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mtx.Lock()
+		s.conns[conn] = struct{}{}
+		s.mtx.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle reads and responds to commands on a connection.
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		s.mtx.Lock()
+		delete(s.conns, conn)
+		s.mtx.Unlock()
+		conn.Close()
+	}()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		err = s.command(rw, fields)
+		if err != nil {
+			return
+		}
+		if rw.Flush() != nil {
+			return
+		}
+	}
+}
+
+// command executes a single command.
+func (s *Server) command(rw *bufio.ReadWriter, fields []string) error {
+	switch fields[0] {
+	case "get", "gets":
+		return s.retrieve(rw, fields[1:])
+	case "set", "add", "replace", "cas":
+		return s.store(rw, fields)
+	case "delete":
+		return s.delete(rw, fields[1:])
+	case "touch":
+		return s.touch(rw, fields[1:])
+	case "incr":
+		return s.incr(rw, fields[1:])
+	case "flush_all":
+		s.mtx.Lock()
+		s.items = make(map[string]item)
+		s.mtx.Unlock()
+		_, err := rw.WriteString("OK\r\n")
+		return err
+	case "version":
+		_, err := rw.WriteString("VERSION 1.6.0\r\n")
+		return err
+	}
+	_, err := rw.WriteString("ERROR\r\n")
+	return err
+}
+
+// retrieve handles get and gets.
+func (s *Server) retrieve(rw *bufio.ReadWriter, keys []string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, k := range keys {
+		it, ok := s.get(k)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(rw, "VALUE %s %d %d %d\r\n", k, it.flags, len(it.value), it.cas)
+		rw.Write(it.value)
+		rw.WriteString("\r\n")
+	}
+	_, err := rw.WriteString("END\r\n")
+	return err
+}
+
+// store handles set, add, replace and cas.
+func (s *Server) store(rw *bufio.ReadWriter, fields []string) error {
+	if len(fields) < 5 {
+		_, err := rw.WriteString("ERROR\r\n")
+		return err
+	}
+	flags, _ := strconv.ParseUint(fields[2], 10, 32)
+	exp, _ := strconv.ParseInt(fields[3], 10, 64)
+	size, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return err
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(rw, data); err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	key := fields[1]
+	existing, exists := s.get(key)
+	switch fields[0] {
+	case "add":
+		if exists {
+			_, err := rw.WriteString("NOT_STORED\r\n")
+			return err
+		}
+	case "replace":
+		if !exists {
+			_, err := rw.WriteString("NOT_STORED\r\n")
+			return err
+		}
+	case "cas":
+		if !exists {
+			_, err := rw.WriteString("NOT_FOUND\r\n")
+			return err
+		}
+		if len(fields) < 6 || fields[5] != strconv.FormatUint(existing.cas, 10) {
+			_, err := rw.WriteString("EXISTS\r\n")
+			return err
+		}
+	}
+
+	s.cas++
+	s.items[key] = item{
+		value:  data[:size],
+		flags:  uint32(flags),
+		expiry: s.expiry(exp),
+		cas:    s.cas,
+	}
+	_, err = rw.WriteString("STORED\r\n")
+	return err
+}
+
+// delete handles delete.
+func (s *Server) delete(rw *bufio.ReadWriter, fields []string) error {
+	if len(fields) == 0 {
+		_, err := rw.WriteString("ERROR\r\n")
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.get(fields[0]); !ok {
+		_, err := rw.WriteString("NOT_FOUND\r\n")
+		return err
+	}
+	delete(s.items, fields[0])
+	_, err := rw.WriteString("DELETED\r\n")
+	return err
+}
+
+// touch handles touch.
+func (s *Server) touch(rw *bufio.ReadWriter, fields []string) error {
+	if len(fields) < 2 {
+		_, err := rw.WriteString("ERROR\r\n")
+		return err
+	}
+	exp, _ := strconv.ParseInt(fields[1], 10, 64)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	it, ok := s.get(fields[0])
+	if !ok {
+		_, err := rw.WriteString("NOT_FOUND\r\n")
+		return err
+	}
+	it.expiry = s.expiry(exp)
+	s.items[fields[0]] = it
+	_, err := rw.WriteString("TOUCHED\r\n")
+	return err
+}
+
+// incr handles incr.
+func (s *Server) incr(rw *bufio.ReadWriter, fields []string) error {
+	if len(fields) < 2 {
+		_, err := rw.WriteString("ERROR\r\n")
+		return err
+	}
+	delta, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		_, err := rw.WriteString("CLIENT_ERROR invalid numeric delta argument\r\n")
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	it, ok := s.get(fields[0])
+	if !ok {
+		_, err := rw.WriteString("NOT_FOUND\r\n")
+		return err
+	}
+	n, err := strconv.ParseUint(string(it.value), 10, 64)
+	if err != nil {
+		_, err := rw.WriteString("CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+		return err
+	}
+	n += delta
+	s.cas++
+	it.value, it.cas = []byte(strconv.FormatUint(n, 10)), s.cas
+	s.items[fields[0]] = it
+	_, err = fmt.Fprintf(rw, "%d\r\n", n)
+	return err
+}
+
+// get returns an unexpired item, expired items are
+// removed. The mutex must be held by the caller.
+func (s *Server) get(key string) (item, bool) {
+	it, ok := s.items[key]
+	if !ok {
+		return item{}, false
+	}
+	if !it.expiry.IsZero() && !s.Now().Before(it.expiry) {
+		delete(s.items, key)
+		return item{}, false
+	}
+	return it, true
+}
+
+// expiry converts a memcached expiration to a time, a
+// zero time means the item does not expire.
+func (s *Server) expiry(exp int64) time.Time {
+	switch {
+	case exp == 0:
+		return time.Time{}
+	case exp < 0:
+		return s.Now()
+	case exp <= relativeExpiryLimit:
+		return s.Now().Add(time.Duration(exp) * time.Second)
+	}
+	return time.Unix(exp, 0)
+}
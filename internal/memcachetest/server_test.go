@@ -0,0 +1,68 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memcachetest
+
+import (
+	"errors"
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	s, err := New()
+	assert.NoError(t, err)
+	defer s.Close()
+
+	now := time.Now()
+	s.Now = func() time.Time { return now }
+
+	c := memcache.New(s.Addr())
+	assert.NoError(t, c.Ping())
+
+	assert.NoError(t, c.Set(&memcache.Item{Key: "key", Value: []byte("value"), Expiration: 10}))
+	item, err := c.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), item.Value)
+	assert.Equal(t, 1, s.Len())
+
+	err = c.Add(&memcache.Item{Key: "key", Value: []byte("other")})
+	assert.True(t, errors.Is(err, memcache.ErrNotStored))
+	err = c.Replace(&memcache.Item{Key: "missing", Value: []byte("other")})
+	assert.True(t, errors.Is(err, memcache.ErrNotStored))
+
+	item.Value = []byte("cas")
+	assert.NoError(t, c.CompareAndSwap(item))
+	assert.True(t, errors.Is(c.CompareAndSwap(item), memcache.ErrCASConflict))
+
+	items, err := c.GetMulti([]string{"key", "missing"})
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+
+	assert.NoError(t, c.Set(&memcache.Item{Key: "expiring", Value: []byte("value"), Expiration: 10}))
+	now = now.Add(time.Second * 11)
+	_, err = c.Get("expiring")
+	assert.True(t, errors.Is(err, memcache.ErrCacheMiss))
+
+	assert.NoError(t, c.Set(&memcache.Item{Key: "key", Value: []byte("value")}))
+	assert.NoError(t, c.Touch("key", 1))
+	assert.True(t, errors.Is(c.Touch("missing", 1), memcache.ErrCacheMiss))
+	assert.NoError(t, c.Delete("key"))
+	assert.True(t, errors.Is(c.Delete("key"), memcache.ErrCacheMiss))
+
+	assert.NoError(t, c.Set(&memcache.Item{Key: "counter", Value: []byte("1")}))
+	n, err := c.Increment("counter", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), n)
+	_, err = c.Increment("missing", 1)
+	assert.True(t, errors.Is(err, memcache.ErrCacheMiss))
+	_, err = c.Increment("expiring", 1)
+	assert.True(t, errors.Is(err, memcache.ErrCacheMiss))
+
+	assert.NoError(t, c.Set(&memcache.Item{Key: "key", Value: []byte("value")}))
+	assert.NoError(t, c.FlushAll())
+	assert.Equal(t, 0, s.Len())
+}
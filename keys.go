@@ -0,0 +1,25 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"crypto/md5"
+	"fmt"
+	"reflect"
+)
+
+// cacheKey returns the key used within the store for the
+// given key, strings are returned as is and any other type
+// is hashed. The checksum matches gocache's cache.Cache
+// so existing items remain readable.
+func cacheKey(key interface{}) string {
+	if s, ok := key.(string); ok {
+		return s
+	}
+	digester := md5.New()
+	fmt.Fprint(digester, reflect.TypeOf(key))
+	fmt.Fprint(digester, key)
+	return fmt.Sprintf("%x", digester.Sum(nil))
+}
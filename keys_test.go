@@ -0,0 +1,25 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"github.com/eko/gocache/v2/cache"
+	"github.com/eko/gocache/v2/store"
+	gocache "github.com/patrickmn/go-cache"
+	"time"
+)
+
+func (t *StashTestSuite) TestCacheKey() {
+	t.Equal("key", cacheKey("key"))
+
+	// Keys must match the gocache checksum so items stored
+	// prior to stash handling keys remain readable.
+	client := gocache.New(time.Hour, time.Hour)
+	err := cache.New(store.NewGoCache(client, nil)).Set(context.Background(), 1, "value", nil)
+	t.NoError(err)
+	_, ok := client.Get(cacheKey(1))
+	t.True(ok)
+}
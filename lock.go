@@ -0,0 +1,92 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"fmt"
+	"github.com/spf13/cast"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// lockShards is the amount of mutexes a keyLock is split
+// into, keys are distributed between them by hash.
+const lockShards = 64
+
+// keyLock defines a sharded mutex owned by each Cache so
+// unrelated caches (and unrelated keys within the same
+// cache) never serialize against each other. The zero
+// value is ready for use.
+type keyLock struct {
+	shards [lockShards]sync.Mutex
+}
+
+// lock acquires the shards for the given keys and
+// returns a function that releases them. Shards are
+// always locked in ascending order to prevent deadlocks
+// when multiple keys are locked at once.
+func (k *keyLock) lock(keys ...interface{}) func() {
+	idx := k.indexes(keys...)
+	for _, i := range idx {
+		k.shards[i].Lock()
+	}
+	return func() {
+		for j := len(idx) - 1; j >= 0; j-- {
+			k.shards[idx[j]].Unlock()
+		}
+	}
+}
+
+// lockAll acquires every shard, used for operations
+// that affect the whole cache such as Clear.
+func (k *keyLock) lockAll() func() {
+	for i := range k.shards {
+		k.shards[i].Lock()
+	}
+	return func() {
+		for i := len(k.shards) - 1; i >= 0; i-- {
+			k.shards[i].Unlock()
+		}
+	}
+}
+
+// indexes returns the sorted and de-duplicated shard
+// indexes for the given keys.
+func (k *keyLock) indexes(keys ...interface{}) []int {
+	seen := make(map[int]struct{}, len(keys))
+	idx := make([]int, 0, len(keys))
+	for _, key := range keys {
+		i := shard(key)
+		if _, ok := seen[i]; ok {
+			continue
+		}
+		seen[i] = struct{}{}
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	return idx
+}
+
+// shard returns the shard index for a key.
+func shard(key interface{}) int {
+	s, err := cast.ToStringE(key)
+	if err != nil {
+		s = fmt.Sprintf("%v", key)
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	return int(h.Sum32() % lockShards)
+}
+
+// tagKeys returns the lock keys for a slice of tags,
+// prefixed so they do not collide with item keys.
+func tagKeys(tags []string) []interface{} {
+	keys := make([]interface{}, len(tags))
+	for i, tag := range tags {
+		keys[i] = "tag:" + tag
+	}
+	return keys
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func (t *StashTestSuite) TestKeyLock_Indexes() {
+	k := keyLock{}
+	got := k.indexes("key", "key", "tag:test")
+	t.LessOrEqual(len(got), 2)
+	for i := 1; i < len(got); i++ {
+		t.Less(got[i-1], got[i])
+	}
+}
+
+func (t *StashTestSuite) TestKeyLock_Lock() {
+	k := keyLock{}
+	var (
+		wg      sync.WaitGroup
+		counter int64
+		active  int64
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer k.lock("key", "tag:one", "tag:two")()
+			if atomic.AddInt64(&active, 1) > 1 {
+				t.Fail("lock held by multiple goroutines")
+			}
+			counter++
+			atomic.AddInt64(&active, -1)
+		}()
+	}
+	wg.Wait()
+	t.Equal(int64(50), counter)
+}
+
+func (t *StashTestSuite) TestKeyLock_LockAll() {
+	k := keyLock{}
+	unlock := k.lockAll()
+	done := make(chan struct{})
+	go func() {
+		defer k.lock("key")()
+		close(done)
+	}()
+	unlock()
+	<-done
+}
+
+func (t *StashTestSuite) TestTagKeys() {
+	got := tagKeys([]string{"one", "two"})
+	t.Equal([]interface{}{"tag:one", "tag:two"}, got)
+}
+
+func (t *StashTestSuite) TestCache_Concurrent() {
+	c, err := Load(NewMemory(time.Hour, time.Hour))
+	t.NoError(err)
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var tmp int
+			_ = c.Set(ctx, i%5, i, Options{Tags: []string{"tag"}})
+			_ = c.Get(ctx, i%5, &tmp)
+			if i%7 == 0 {
+				_ = c.Invalidate(ctx, InvalidateOptions{Tags: []string{"tag"}})
+			}
+			_ = c.Delete(ctx, i%5)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -5,10 +5,13 @@
 package stash
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/bradfitz/gomemcache/memcache"
-	"github.com/eko/gocache/v2/cache"
 	"github.com/eko/gocache/v2/store"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,6 +21,10 @@ type memcacheStore struct {
 	client            *memcache.Client
 	servers           []string
 	defaultExpiration time.Duration
+	// owned is true when the client was created by the
+	// provider and should be closed with it.
+	owned  bool
+	closer closeOnce
 }
 
 // NewMemcache creates a new memcached store and returns a provider.
@@ -26,9 +33,38 @@ func NewMemcache(servers []string, defaultExpiration time.Duration) Provider {
 		client:            memcache.New(servers...),
 		servers:           servers,
 		defaultExpiration: defaultExpiration,
+		owned:             true,
 	}
 }
 
+// memcacheClientStore defines the data stored for a
+// memcached store using an existing client.
+type memcacheClientStore struct {
+	*memcacheStore
+}
+
+// NewMemcacheClient creates a new memcached store from an
+// existing client and returns a provider. The client is
+// not closed when the provider is. The Driver is
+// MemcacheDriver.
+func NewMemcacheClient(client *memcache.Client, defaultExpiration time.Duration) Provider {
+	return &memcacheClientStore{
+		memcacheStore: &memcacheStore{
+			client:            client,
+			defaultExpiration: defaultExpiration,
+		},
+	}
+}
+
+// Validate satisfies the Provider interface by checking
+// the client is not nil.
+func (m *memcacheClientStore) Validate() error {
+	if m.client == nil {
+		return errors.New("no memcache client defined")
+	}
+	return nil
+}
+
 // Validate satisfies the Provider interface by checking
 // for environment variables.
 func (m *memcacheStore) Validate() error {
@@ -47,9 +83,12 @@ func (m *memcacheStore) Driver() string {
 // Store satisfies the Provider interface by creating a
 // new store.StoreInterface.
 func (m *memcacheStore) Store() store.StoreInterface {
-	return cache.New(store.NewMemcache(m.client, &store.Options{
-		Expiration: m.defaultExpiration,
-	}))
+	return &memcacheExtendedStore{
+		MemcacheStore: store.NewMemcache(m.client, &store.Options{
+			Expiration: m.defaultExpiration,
+		}),
+		client: m.client,
+	}
 }
 
 // Ping satisfies the Provider interface by pinging the
@@ -57,3 +96,288 @@ func (m *memcacheStore) Store() store.StoreInterface {
 func (m *memcacheStore) Ping() error {
 	return m.client.Ping()
 }
+
+// Close satisfies the Provider interface by closing the
+// client's idle connections if it was created by the
+// provider.
+func (m *memcacheStore) Close(_ context.Context) error {
+	if !m.owned {
+		return nil
+	}
+	return m.closer.close(m.client.Close)
+}
+
+// memcacheTTLPrefix is the prefix of the key used to store
+// the expiry time of a memcache item.
+const memcacheTTLPrefix = "stash_ttl_"
+
+// memcacheExtendedStore extends the gocache memcache store to
+// emulate GetWithTTL, retrieve keys in batches and resolve
+// tags. Memcached cannot report the remaining TTL of an
+// item, so the expiry time is written to a sibling key on
+// Set and retrieved alongside the item.
+type memcacheExtendedStore struct {
+	*store.MemcacheStore
+	client *memcache.Client
+}
+
+// Set stores the item and its expiry time.
+func (m *memcacheExtendedStore) Set(ctx context.Context, key interface{}, value interface{}, options *store.Options) error {
+	err := m.MemcacheStore.Set(ctx, key, value, options)
+	if err != nil {
+		return err
+	}
+	return m.setTTL(key.(string), options)
+}
+
+// Add satisfies the ConditionalSetter interface using
+// memcached's add command, the tags and expiry time are
+// stored once the item is.
+func (m *memcacheExtendedStore) Add(_ context.Context, key string, value []byte, options *store.Options) error {
+	err := m.client.Add(memcacheItem(key, value, options))
+	if errors.Is(err, memcache.ErrNotStored) {
+		return ErrKeyExists
+	}
+	if err != nil {
+		return err
+	}
+	return m.stored(key, options)
+}
+
+// Replace satisfies the ConditionalSetter interface using
+// memcached's replace command, the tags and expiry time
+// are stored once the item is.
+func (m *memcacheExtendedStore) Replace(_ context.Context, key string, value []byte, options *store.Options) error {
+	err := m.client.Replace(memcacheItem(key, value, options))
+	if errors.Is(err, memcache.ErrNotStored) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return m.stored(key, options)
+}
+
+// memcacheItem creates the memcache item for a key,
+// matching the gocache store's Set.
+func memcacheItem(key string, value []byte, options *store.Options) *memcache.Item {
+	item := &memcache.Item{Key: key, Value: value}
+	if options != nil {
+		item.Expiration = int32(options.Expiration.Seconds())
+	}
+	return item
+}
+
+// stored adds the key to its tags, matching the gocache
+// store's Set, and stores its expiry time.
+func (m *memcacheExtendedStore) stored(key string, options *store.Options) error {
+	if options != nil {
+		for _, tag := range options.Tags {
+			tagKey := fmt.Sprintf(store.MemcacheTagPattern, tag)
+			var keys []string
+			item, err := m.client.Get(tagKey)
+			if err == nil {
+				keys = strings.Split(string(item.Value), ",")
+			} else if !errors.Is(err, memcache.ErrCacheMiss) {
+				return err
+			}
+			if !contains(keys, key) {
+				keys = append(keys, key)
+			}
+			err = m.client.Set(&memcache.Item{
+				Key:        tagKey,
+				Value:      []byte(strings.Join(keys, ",")),
+				Expiration: int32(memcacheTagExpiration.Seconds()),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return m.setTTL(key, options)
+}
+
+// memcacheTagExpiration is the expiration of the items
+// used to store tags, matching gocache's memcache store.
+const memcacheTagExpiration = 720 * time.Hour
+
+// contains reports whether s is within the slice.
+func contains(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// setTTL stores the expiry time of the key in its sibling
+// key, or removes it if the item does not expire.
+func (m *memcacheExtendedStore) setTTL(key string, options *store.Options) error {
+	ttlKey := memcacheTTLPrefix + key
+	if options == nil || options.Expiration <= 0 {
+		err := m.client.Delete(ttlKey)
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			return nil
+		}
+		return err
+	}
+
+	expiry := time.Now().Add(options.Expiration)
+	return m.client.Set(&memcache.Item{
+		Key:        ttlKey,
+		Value:      []byte(strconv.FormatInt(expiry.UnixNano(), 10)),
+		Expiration: int32(options.Expiration.Seconds()),
+	})
+}
+
+// GetWithTTL retrieves the item and its expiry time in a
+// single round trip. Items without an expiry time return
+// NoExpiration.
+func (m *memcacheExtendedStore) GetWithTTL(_ context.Context, key interface{}) (interface{}, time.Duration, error) {
+	k := key.(string)
+	items, err := m.client.GetMulti([]string{k, memcacheTTLPrefix + k})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	item, ok := items[k]
+	if !ok {
+		return nil, 0, memcache.ErrCacheMiss
+	}
+
+	ttl, ok := items[memcacheTTLPrefix+k]
+	if !ok {
+		return item.Value, NoExpiration, nil
+	}
+
+	expiry, err := strconv.ParseInt(string(ttl.Value), 10, 64)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return item.Value, time.Until(time.Unix(0, expiry)), nil
+}
+
+// Delete removes the item and its expiry time. Deleting
+// a key that does not exist is not an error, matching the
+// other stores.
+func (m *memcacheExtendedStore) Delete(ctx context.Context, key interface{}) error {
+	err := m.MemcacheStore.Delete(ctx, key)
+	if err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		return err
+	}
+	err = m.client.Delete(memcacheTTLPrefix + key.(string))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil
+	}
+	return err
+}
+
+// GetMany satisfies the BatchGetter interface by
+// retrieving all keys with a single GetMulti.
+func (m *memcacheExtendedStore) GetMany(_ context.Context, keys []string) ([]interface{}, []error) {
+	values := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	if len(keys) == 0 {
+		return values, errs
+	}
+
+	items, err := m.client.GetMulti(keys)
+	for i, key := range keys {
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		item, ok := items[key]
+		if !ok {
+			errs[i] = memcache.ErrCacheMiss
+			continue
+		}
+		values[i] = item.Value
+	}
+
+	return values, errs
+}
+
+// memcacheGenerationPrefix is the prefix of the key used
+// to store the generation of a namespace.
+const memcacheGenerationPrefix = "stash_gen_"
+
+// Generations satisfies the GenerationCounter interface
+// by retrieving every namespace's generation with a single
+// GetMulti, starting a generation for namespaces that do
+// not have one.
+func (m *memcacheExtendedStore) Generations(_ context.Context, namespaces []string) ([]uint64, error) {
+	keys := make([]string, len(namespaces))
+	for i, namespace := range namespaces {
+		keys[i] = memcacheGenerationPrefix + namespace
+	}
+	items, err := m.client.GetMulti(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	gens := make([]uint64, len(keys))
+	for i, key := range keys {
+		item, ok := items[key]
+		if !ok {
+			gens[i], err = m.startGeneration(key)
+		} else {
+			gens[i], err = strconv.ParseUint(string(item.Value), 10, 64)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return gens, nil
+}
+
+// IncrGeneration satisfies the GenerationCounter
+// interface by incrementing the namespace's generation.
+func (m *memcacheExtendedStore) IncrGeneration(_ context.Context, namespace string) error {
+	key := memcacheGenerationPrefix + namespace
+	_, err := m.client.Increment(key, 1)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		_, err = m.startGeneration(key)
+	}
+	return err
+}
+
+// startGeneration stores the first generation of a
+// namespace, returning the generation stored by another
+// client if there is one. The current time is used so a
+// generation evicted from memcached is never reused.
+func (m *memcacheExtendedStore) startGeneration(key string) (uint64, error) {
+	gen := uint64(time.Now().UnixNano())
+	err := m.client.Add(&memcache.Item{Key: key, Value: []byte(strconv.FormatUint(gen, 10))})
+	if !errors.Is(err, memcache.ErrNotStored) {
+		return gen, err
+	}
+	item, err := m.client.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(string(item.Value), 10, 64)
+}
+
+// TagKeys satisfies the TagResolver interface by reading
+// the comma separated keys stored against each tag.
+func (m *memcacheExtendedStore) TagKeys(_ context.Context, tags []string) ([]string, error) {
+	var keys []string
+	for _, tag := range tags {
+		item, err := m.client.Get(fmt.Sprintf(store.MemcacheTagPattern, tag))
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range strings.Split(string(item.Value), ",") {
+			if key != "" {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
@@ -5,7 +5,9 @@
 package stash
 
 import (
+	"context"
 	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/lacuna-seo/stash/internal/memcachetest"
 	"time"
 )
 
@@ -24,3 +26,66 @@ func (t *StashTestSuite) TestMemcache() {
 		client: memcache.New(""),
 	})
 }
+
+func (t *StashTestSuite) TestMemcache_TTL() {
+	srv, err := memcachetest.New()
+	t.NoError(err)
+	defer srv.Close()
+
+	c, err := Load(NewMemcache([]string{srv.Addr()}, time.Hour))
+	t.NoError(err)
+
+	ctx := context.Background()
+	t.NoError(c.Set(ctx, "expiring", "stash", Options{Expiration: time.Minute}))
+	t.NoError(c.Set(ctx, "forever", "stash", Options{}))
+
+	var got string
+	ttl, err := c.GetWithTTL(ctx, "expiring", &got)
+	t.NoError(err)
+	t.Equal("stash", got)
+	t.InDelta(time.Minute, ttl, float64(time.Second))
+
+	ttl, err = c.TTL(ctx, "forever")
+	t.NoError(err)
+	t.Equal(NoExpiration, ttl)
+
+	// Removing the expiration removes the sibling TTL key.
+	t.NoError(c.Set(ctx, "expiring", "stash", Options{}))
+	ttl, err = c.TTL(ctx, "expiring")
+	t.NoError(err)
+	t.Equal(NoExpiration, ttl)
+
+	t.NoError(c.Set(ctx, "expiring", "stash", Options{Expiration: time.Minute}))
+	t.NoError(c.Delete(ctx, "expiring"))
+	t.Equal(1, srv.Len())
+
+	_, err = c.TTL(ctx, "missing")
+	t.ErrorIs(err, ErrNotFound)
+}
+
+func (t *StashTestSuite) TestMemcacheClient() {
+	t.EqualError(NewMemcacheClient(nil, time.Second).Validate(), "no memcache client defined")
+
+	srv, err := memcachetest.New()
+	t.NoError(err)
+	defer srv.Close()
+
+	client := memcache.New(srv.Addr())
+	c, err := Load(NewMemcacheClient(client, time.Hour))
+	t.NoError(err)
+	t.Equal(MemcacheDriver, c.Driver)
+
+	ctx := context.Background()
+	t.NoError(c.Set(ctx, "key", "stash", Options{}))
+	t.NoError(c.Close(ctx))
+
+	// The client was passed in, so it is left open.
+	t.NoError(client.Ping())
+	t.ErrorIs(c.Get(ctx, "key", new(string)), ErrClosed)
+
+	c, err = Load(NewMemcacheClient(client, time.Hour))
+	t.NoError(err)
+	var got string
+	t.NoError(c.Get(ctx, "key", &got))
+	t.Equal("stash", got)
+}
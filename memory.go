@@ -5,22 +5,90 @@
 package stash
 
 import (
-	"github.com/eko/gocache/v2/cache"
+	"context"
+	"fmt"
 	"github.com/eko/gocache/v2/store"
 	gocache "github.com/patrickmn/go-cache"
+	"strings"
+	"sync"
 	"time"
 )
 
+// Clock defines the source of the current time used by
+// the memory provider to expire items, it must be safe
+// for concurrent use.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock used by default, reading the
+// wall clock.
+type systemClock struct{}
+
+// Now satisfies the Clock interface by returning the
+// current time.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// MemoryOption configures the provider returned by
+// NewMemory.
+type MemoryOption func(m *memoryStore)
+
+// WithMemoryClock sets the Clock used to expire items and
+// report their TTLs, so tests can advance time rather than
+// sleeping. The janitor still runs every cleanupInterval
+// of wall time, deleting the items expired by the Clock.
+func WithMemoryClock(c Clock) MemoryOption {
+	return func(m *memoryStore) {
+		m.client.clock = c
+	}
+}
+
 // memoryStore defines the data stored for the go-cache
 // client.
 type memoryStore struct {
-	client *gocache.Cache
+	client *memoryClient
+	stop   chan struct{}
+	closer closeOnce
 }
 
 // NewMemory creates a new go-cache store and returns a provider.
-func NewMemory(defaultExpiration, cleanupInterval time.Duration) Provider {
-	return &memoryStore{
-		client: gocache.New(defaultExpiration, cleanupInterval),
+// Expired items are deleted every cleanupInterval until the
+// provider is closed, they are never deleted if the interval
+// is zero or less.
+func NewMemory(defaultExpiration, cleanupInterval time.Duration, opts ...MemoryOption) Provider {
+	m := &memoryStore{
+		client: &memoryClient{
+			cache:             gocache.New(gocache.NoExpiration, 0),
+			clock:             systemClock{},
+			defaultExpiration: defaultExpiration,
+		},
+		stop: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if cleanupInterval > 0 {
+		go m.janitor(cleanupInterval)
+	}
+	return m
+}
+
+// janitor deletes expired items every interval until the
+// provider is closed. go-cache's own janitor is only
+// stopped once the cache is garbage collected, so it is
+// replaced.
+func (m *memoryStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.client.deleteExpired()
+		case <-m.stop:
+			return
+		}
 	}
 }
 
@@ -39,7 +107,10 @@ func (m *memoryStore) Driver() string {
 // Store satisfies the Provider interface by creating a
 // new store.StoreInterface.
 func (m *memoryStore) Store() store.StoreInterface {
-	return cache.New(store.NewGoCache(m.client, nil))
+	return &memoryExtendedStore{
+		GoCacheStore: store.NewGoCache(m.client, nil),
+		client:       m.client,
+	}
 }
 
 // Ping satisfies the Provider interface by pinging the
@@ -47,3 +118,234 @@ func (m *memoryStore) Store() store.StoreInterface {
 func (m *memoryStore) Ping() error {
 	return nil
 }
+
+// Close satisfies the Provider interface by stopping the
+// janitor, items are left in memory.
+func (m *memoryStore) Close(_ context.Context) error {
+	return m.closer.close(func() error {
+		if m.stop != nil {
+			close(m.stop)
+		}
+		return nil
+	})
+}
+
+// memoryExtendedStore extends the gocache memory store
+// with clearing keys by prefix and resolving tags.
+type memoryExtendedStore struct {
+	*store.GoCacheStore
+	client *memoryClient
+}
+
+// ClearPrefix satisfies the PrefixClearer interface by
+// deleting every key that begins with the prefix.
+func (m *memoryExtendedStore) ClearPrefix(_ context.Context, prefix string) error {
+	for key := range m.client.cache.Items() {
+		if strings.HasPrefix(key, prefix) {
+			m.client.Delete(key)
+		}
+	}
+	return nil
+}
+
+// Exists satisfies the ExistenceChecker interface by
+// looking up each key without copying its value.
+func (m *memoryExtendedStore) Exists(_ context.Context, keys []string) ([]bool, error) {
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		_, found[i] = m.client.Get(key)
+	}
+	return found, nil
+}
+
+// Add satisfies the ConditionalSetter interface by
+// checking and storing the item under the client's lock.
+func (m *memoryExtendedStore) Add(_ context.Context, key string, value []byte, options *store.Options) error {
+	if !m.client.setIf(key, value, memoryExpiration(options), false) {
+		return ErrKeyExists
+	}
+	m.setTags(key, options)
+	return nil
+}
+
+// Replace satisfies the ConditionalSetter interface by
+// checking and storing the item under the client's lock.
+func (m *memoryExtendedStore) Replace(_ context.Context, key string, value []byte, options *store.Options) error {
+	if !m.client.setIf(key, value, memoryExpiration(options), true) {
+		return ErrNotFound
+	}
+	m.setTags(key, options)
+	return nil
+}
+
+// memoryExpiration returns the go-cache expiration for
+// the options, matching the gocache store's Set.
+func memoryExpiration(options *store.Options) time.Duration {
+	if options == nil {
+		return gocache.DefaultExpiration
+	}
+	return options.Expiration
+}
+
+// setTags adds the key to the set of keys stored against
+// each tag, matching the gocache store's Set.
+func (m *memoryExtendedStore) setTags(key string, options *store.Options) {
+	if options == nil {
+		return
+	}
+	for _, tag := range options.Tags {
+		tagKey := fmt.Sprintf(store.GoCacheTagPattern, tag)
+		keys := map[string]struct{}{key: {}}
+		if result, ok := m.client.Get(tagKey); ok {
+			if cacheKeys, ok := result.(map[string]struct{}); ok {
+				for k := range cacheKeys {
+					keys[k] = struct{}{}
+				}
+			}
+		}
+		m.client.Set(tagKey, keys, memoryTagExpiration)
+	}
+}
+
+// memoryTagExpiration is the expiration of the sets used
+// to store tags, matching gocache's memory store.
+const memoryTagExpiration = 720 * time.Hour
+
+// TagKeys satisfies the TagResolver interface by reading
+// the keys stored against each tag.
+func (m *memoryExtendedStore) TagKeys(_ context.Context, tags []string) ([]string, error) {
+	var keys []string
+	for _, tag := range tags {
+		result, ok := m.client.Get(fmt.Sprintf(store.GoCacheTagPattern, tag))
+		if !ok {
+			continue
+		}
+		if cacheKeys, ok := result.(map[string]struct{}); ok {
+			for key := range cacheKeys {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// memoryClient defines the go-cache client used by the
+// gocache store, it expires items using a Clock rather
+// than go-cache's own expiration, which always reads the
+// wall clock. Items are stored in go-cache without an
+// expiration, wrapped with the time they expire.
+type memoryClient struct {
+	cache             *gocache.Cache
+	clock             Clock
+	defaultExpiration time.Duration
+	// mtx prevents an item being replaced between
+	// deleteExpired finding it expired and deleting it.
+	mtx sync.Mutex
+}
+
+// memoryItem defines a value stored by the memoryClient,
+// a zero expiry means the item does not expire.
+type memoryItem struct {
+	value  interface{}
+	expiry time.Time
+}
+
+// Get satisfies the store.GoCacheClientInterface by
+// returning an unexpired item.
+func (m *memoryClient) Get(k string) (interface{}, bool) {
+	value, _, ok := m.GetWithExpiration(k)
+	return value, ok
+}
+
+// GetWithExpiration satisfies the
+// store.GoCacheClientInterface by returning an unexpired
+// item and the time it expires, or the zero time if it
+// does not expire. The gocache store measures the TTL
+// against the wall clock, so the time returned is the
+// wall clock time the item would expire at.
+func (m *memoryClient) GetWithExpiration(k string) (interface{}, time.Time, bool) {
+	result, ok := m.cache.Get(k)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	item, ok := result.(memoryItem)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	if item.expiry.IsZero() {
+		return item.value, time.Time{}, true
+	}
+	now := m.clock.Now()
+	if expired(item, now) {
+		return nil, time.Time{}, false
+	}
+	return item.value, time.Now().Add(item.expiry.Sub(now)), true
+}
+
+// Set satisfies the store.GoCacheClientInterface by
+// storing the item, an expiration of
+// gocache.DefaultExpiration uses the provider's default
+// and gocache.NoExpiration never expires.
+func (m *memoryClient) Set(k string, x interface{}, d time.Duration) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.set(k, x, d)
+}
+
+// setIf stores the item if the key exists (replace) or
+// does not exist (add), reporting whether it was stored.
+func (m *memoryClient) setIf(k string, x interface{}, d time.Duration, replace bool) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, ok := m.Get(k); ok != replace {
+		return false
+	}
+	m.set(k, x, d)
+	return true
+}
+
+// set stores the item, the mutex must be held.
+func (m *memoryClient) set(k string, x interface{}, d time.Duration) {
+	if d == gocache.DefaultExpiration {
+		d = m.defaultExpiration
+	}
+	item := memoryItem{value: x}
+	if d > 0 {
+		item.expiry = m.clock.Now().Add(d)
+	}
+	m.cache.Set(k, item, gocache.NoExpiration)
+}
+
+// Delete satisfies the store.GoCacheClientInterface by
+// removing the item.
+func (m *memoryClient) Delete(k string) {
+	m.cache.Delete(k)
+}
+
+// Flush satisfies the store.GoCacheClientInterface by
+// removing every item.
+func (m *memoryClient) Flush() {
+	m.cache.Flush()
+}
+
+// deleteExpired removes every item expired by the clock.
+func (m *memoryClient) deleteExpired() {
+	now := m.clock.Now()
+	for k, it := range m.cache.Items() {
+		if !expired(it.Object, now) {
+			continue
+		}
+		m.mtx.Lock()
+		if result, ok := m.cache.Get(k); ok && expired(result, now) {
+			m.cache.Delete(k)
+		}
+		m.mtx.Unlock()
+	}
+}
+
+// expired reports whether a value stored by the
+// memoryClient has expired at now.
+func expired(result interface{}, now time.Time) bool {
+	item, ok := result.(memoryItem)
+	return ok && !item.expiry.IsZero() && !now.Before(item.expiry)
+}
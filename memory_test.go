@@ -4,7 +4,11 @@
 
 package stash
 
-import "time"
+import (
+	"context"
+	"sync"
+	"time"
+)
 
 func (t *StashTestSuite) TestMemory() {
 	got := NewMemory(time.Second*1, time.Second*1)
@@ -16,3 +20,83 @@ func (t *StashTestSuite) TestMemory() {
 	t.NotNil(store)
 	t.Nil(m.Ping())
 }
+
+func (t *StashTestSuite) TestMemory_TTL() {
+	c, err := Load(NewMemory(time.Hour, time.Hour))
+	t.NoError(err)
+
+	ctx := context.Background()
+	t.NoError(c.Set(ctx, "expiring", "stash", Options{Expiration: time.Minute}))
+	t.NoError(c.Set(ctx, "forever", "stash", Options{Expiration: RememberForever}))
+
+	var got string
+	ttl, err := c.GetWithTTL(ctx, "expiring", &got)
+	t.NoError(err)
+	t.Equal("stash", got)
+	t.InDelta(time.Minute, ttl, float64(time.Second))
+
+	ttl, err = c.TTL(ctx, "forever")
+	t.NoError(err)
+	t.Equal(NoExpiration, ttl)
+
+	_, err = c.TTL(ctx, "missing")
+	t.ErrorIs(err, ErrNotFound)
+}
+
+// fakeClock is a Clock advanced manually.
+type fakeClock struct {
+	mtx sync.Mutex
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.now = f.now.Add(d)
+}
+
+func (t *StashTestSuite) TestMemory_Clock() {
+	clock := &fakeClock{now: time.Now()}
+	prov := NewMemory(time.Hour, 0, WithMemoryClock(clock))
+	c, err := Load(prov)
+	t.NoError(err)
+
+	ctx := context.Background()
+	t.NoError(c.Set(ctx, "expiring", "stash", Options{Expiration: time.Minute, Tags: []string{"tag"}}))
+	t.NoError(c.Set(ctx, "default", "stash", Options{}))
+	t.NoError(c.Set(ctx, "forever", "stash", Options{Expiration: RememberForever}))
+
+	clock.Advance(time.Second * 30)
+	ttl, err := c.TTL(ctx, "expiring")
+	t.NoError(err)
+	t.InDelta(time.Second*30, ttl, float64(time.Second))
+
+	clock.Advance(time.Second * 30)
+	t.ErrorIs(c.Get(ctx, "expiring", new(string)), ErrNotFound)
+	t.NoError(c.Get(ctx, "default", new(string)))
+
+	// Invalidating a tag removes its items whether or not
+	// they have expired.
+	t.NoError(c.Set(ctx, "tagged", "stash", Options{Expiration: time.Hour, Tags: []string{"tag"}}))
+	t.NoError(c.Invalidate(ctx, InvalidateOptions{Tags: []string{"tag"}}))
+	t.ErrorIs(c.Get(ctx, "tagged", new(string)), ErrNotFound)
+
+	clock.Advance(time.Hour)
+	t.ErrorIs(c.Get(ctx, "default", new(string)), ErrNotFound)
+	ttl, err = c.TTL(ctx, "forever")
+	t.NoError(err)
+	t.Equal(NoExpiration, ttl)
+
+	// The expired items remain in memory until the
+	// janitor deletes them.
+	client := prov.(*memoryStore).client
+	t.Equal(3, client.cache.ItemCount())
+	client.deleteExpired()
+	t.Equal(2, client.cache.ItemCount())
+}
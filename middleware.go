@@ -0,0 +1,146 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Call defines a single operation against the store,
+// passed through the Middleware configured on the Cache.
+// Middleware can inspect and modify the call before
+// passing it to the next Handler, and inspect the result
+// once it returns.
+type Call struct {
+	// Operation is the store operation, one of
+	// OperationGet, OperationGetWithTTL, OperationTTL,
+	// OperationExists, OperationSet, OperationAdd,
+	// OperationReplace, OperationDelete,
+	// OperationInvalidate or OperationClear.
+	Operation string
+	// Key is the key in the form used within the store,
+	// it is empty for Invalidate and Clear. Changing the
+	// key changes the key used within the store. Stores
+	// that implement GenerationCounter hold the key with
+	// the namespace's generation added.
+	Key string
+	// Value is the serialized (and compressed) value. It
+	// is set before the call for Set, Add and Replace, and
+	// populated once the call returns for Get and
+	// GetWithTTL.
+	Value []byte
+	// TTL is the remaining time to live of the item,
+	// populated once the call returns for GetWithTTL and
+	// TTL.
+	TTL time.Duration
+	// Options are the tags and expiration time of the
+	// item for Set, Add and Replace. Like the key, tags
+	// are in the form used within the store, prefixed by
+	// the namespace.
+	Options Options
+	// InvalidateOptions are the tags to invalidate for
+	// Invalidate, in the same form as the tags in Options.
+	InvalidateOptions InvalidateOptions
+}
+
+// Handler defines a function that performs a Call,
+// ErrNotFound is returned if the key does not exist and
+// ErrKeyExists if it does for Add.
+type Handler func(ctx context.Context, call *Call) error
+
+// Middleware defines a function that wraps a Handler to
+// add behaviour around every store operation, such as
+// logging, fault injection or transforming values.
+type Middleware func(next Handler) Handler
+
+// WithMiddleware wraps every store operation performed by
+// the Cache with the middleware passed, the first
+// middleware is the outermost. It can be passed multiple
+// times, the middleware is appended.
+//
+// Batch operations are performed one key at a time when
+// middleware is configured, so every key passes through
+// the chain.
+func WithMiddleware(mw ...Middleware) LoadOption {
+	return func(c *Cache) {
+		c.middleware = append(c.middleware, mw...)
+	}
+}
+
+// handle passes the call through the middleware chain to
+// the store.
+func (c *Cache) handle(ctx context.Context, call *Call) error {
+	h := Handler(c.execute)
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		h = c.middleware[i](h)
+	}
+	return h(ctx, call)
+}
+
+// execute performs the call against the store, it is the
+// innermost Handler of the chain. The key includes the
+// namespace's generation for stores that implement
+// GenerationCounter.
+func (c *Cache) execute(ctx context.Context, call *Call) error {
+	key := call.Key
+	if key != "" {
+		var err error
+		key, err = c.storeKey(ctx, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch call.Operation {
+	case OperationGet:
+		result, err := c.store.Get(ctx, key)
+		if err != nil {
+			return notFound(err)
+		}
+		call.Value = toBytes(result)
+		return nil
+	case OperationGetWithTTL, OperationTTL:
+		result, ttl, err := c.store.GetWithTTL(ctx, key)
+		if err != nil {
+			return notFound(err)
+		}
+		call.Value, call.TTL = toBytes(result), normaliseTTL(ttl)
+		return nil
+	case OperationExists:
+		found, err := exists(ctx, c.store, []string{key})
+		if err != nil {
+			return err
+		}
+		if !found[0] {
+			return ErrNotFound
+		}
+		return nil
+	case OperationSet:
+		return c.store.Set(ctx, key, call.Value, call.Options.toStore())
+	case OperationAdd, OperationReplace:
+		return setIf(ctx, c.store, key, call.Value, call.Options.toStore(), call.Operation == OperationReplace)
+	case OperationDelete:
+		return c.store.Delete(ctx, key)
+	case OperationInvalidate:
+		return c.store.Invalidate(ctx, call.InvalidateOptions.toStore())
+	case OperationClear:
+		return clearNamespace(ctx, c.store, c.namespace)
+	}
+	return fmt.Errorf("stash: unknown operation %q", call.Operation)
+}
+
+// toBytes converts a value returned by the store to a
+// byte slice.
+func toBytes(result interface{}) []byte {
+	switch r := result.(type) {
+	case []byte:
+		return r
+	case string:
+		return []byte(r)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"strings"
+	"time"
+)
+
+// xor is a middleware that transforms values on the way
+// in and out of the store.
+func xor(next Handler) Handler {
+	return func(ctx context.Context, call *Call) error {
+		if call.Operation == OperationSet {
+			call.Value = xorBytes(call.Value)
+		}
+		err := next(ctx, call)
+		if err == nil && call.Value != nil && call.Operation != OperationSet {
+			call.Value = xorBytes(call.Value)
+		}
+		return err
+	}
+}
+
+func xorBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[i] = b[i] ^ 0xff
+	}
+	return out
+}
+
+func (t *StashTestSuite) TestCache_WithMiddleware() {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, call *Call) error {
+				calls = append(calls, name+" "+call.Operation+" "+call.Key)
+				return next(ctx, call)
+			}
+		}
+	}
+
+	c, err := Load(NewMemory(time.Hour, time.Hour), WithMiddleware(record("a"), record("b")), WithMiddleware(xor))
+	t.NoError(err)
+	ctx := context.Background()
+
+	t.NoError(c.Set(ctx, "key", "value", Options{Tags: []string{"tag"}}))
+	raw, err := c.store.Get(ctx, "key")
+	t.NoError(err)
+	marshal, err := c.marshal("value")
+	t.NoError(err)
+	t.Equal(xorBytes(marshal), raw)
+
+	var got string
+	t.NoError(c.Get(ctx, "key", &got))
+	t.Equal("value", got)
+
+	ttl, err := c.GetWithTTL(ctx, "key", &got)
+	t.NoError(err)
+	t.Greater(ttl, time.Duration(0))
+	t.Equal("value", got)
+
+	t.NoError(c.Invalidate(ctx, InvalidateOptions{Tags: []string{"tag"}}))
+	t.ErrorIs(c.Get(ctx, "key", &got), ErrNotFound)
+	t.NoError(c.Clear(ctx))
+
+	t.Equal([]string{
+		"a set key", "b set key",
+		"a get key", "b get key",
+		"a get_with_ttl key", "b get_with_ttl key",
+		"a invalidate ", "b invalidate ",
+		"a get key", "b get key",
+		"a clear ", "b clear ",
+	}, calls)
+}
+
+func (t *StashTestSuite) TestCache_WithMiddleware_Key() {
+	prefix := func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) error {
+			if call.Key != "" {
+				call.Key = "hashed:" + call.Key
+			}
+			return next(ctx, call)
+		}
+	}
+
+	c, err := Load(NewMemory(time.Hour, time.Hour), WithMiddleware(prefix))
+	t.NoError(err)
+	ctx := context.Background()
+
+	t.NoError(c.Set(ctx, "key", "value", Options{}))
+	_, err = c.store.Get(ctx, "hashed:key")
+	t.NoError(err)
+
+	var got string
+	t.NoError(c.Get(ctx, "key", &got))
+	t.Equal("value", got)
+
+	t.NoError(c.Delete(ctx, "key"))
+	_, err = c.store.Get(ctx, "hashed:key")
+	t.Error(err)
+}
+
+func (t *StashTestSuite) TestCache_WithMiddleware_Namespace() {
+	var calls []string
+	record := func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) error {
+			calls = append(calls, call.Operation+" "+call.Key+" "+strings.Join(call.Options.Tags, ",")+strings.Join(call.InvalidateOptions.Tags, ","))
+			return next(ctx, call)
+		}
+	}
+
+	c, err := Load(NewMemory(time.Hour, time.Hour), WithNamespace("ns"), WithMiddleware(record))
+	t.NoError(err)
+	ctx := context.Background()
+
+	t.NoError(c.Set(ctx, "key", "value", Options{Tags: []string{"tag"}}))
+	t.NoError(c.SetMany(ctx, Item{Key: "other", Value: "value", Options: Options{Tags: []string{"tag"}}}).Err())
+	t.NoError(c.Invalidate(ctx, InvalidateOptions{Tags: []string{"tag"}}))
+	t.ErrorIs(c.Get(ctx, "key", new(string)), ErrNotFound)
+	t.ErrorIs(c.Get(ctx, "other", new(string)), ErrNotFound)
+
+	t.Equal([]string{
+		"set ns:key ns:tag",
+		"set ns:other ns:tag",
+		"invalidate  ns:tag",
+		"get ns:key ",
+		"get ns:other ",
+	}, calls)
+}
+
+func (t *StashTestSuite) TestCache_WithMiddleware_Error() {
+	errInjected := errors.New("injected")
+	fail := func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) error {
+			if call.Operation == OperationDelete || call.Key == "fail" {
+				return errInjected
+			}
+			return next(ctx, call)
+		}
+	}
+
+	c, err := Load(NewMemory(time.Hour, time.Hour), WithMiddleware(fail))
+	t.NoError(err)
+	ctx := context.Background()
+
+	t.ErrorIs(c.Delete(ctx, "key"), errInjected)
+	t.ErrorIs(c.Set(ctx, "fail", "value", Options{}), errInjected)
+
+	results := c.SetMany(ctx, Item{Key: "ok", Value: "value"}, Item{Key: "fail", Value: "value"})
+	t.NoError(results[0].Err)
+	t.ErrorIs(results[1].Err, errInjected)
+}
+
+func (t *StashTestSuite) TestCache_WithMiddleware_Batch() {
+	mr := miniredis.RunT(t.T())
+	var keys []string
+	record := func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) error {
+			keys = append(keys, call.Operation+" "+call.Key)
+			return next(ctx, call)
+		}
+	}
+
+	c, err := Load(NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour), WithMiddleware(record, xor))
+	t.NoError(err)
+	ctx := context.Background()
+
+	t.NoError(c.SetMany(ctx, Item{Key: "a", Value: "a"}, Item{Key: "b", Value: "b"}).Err())
+	raw, err := mr.Get("a")
+	t.NoError(err)
+	t.False(bytes.Contains([]byte(raw), []byte(`"a"`)))
+
+	results := c.GetMany(ctx, "a", "b", "c")
+	var got string
+	t.NoError(results[0].Decode(&got))
+	t.Equal("a", got)
+	t.NoError(results[1].Decode(&got))
+	t.Equal("b", got)
+	t.ErrorIs(results[2].Err, ErrNotFound)
+
+	t.NoError(c.DeleteMany(ctx, "a", "b").Err())
+	t.False(mr.Exists("a"))
+
+	t.Equal([]string{
+		"set a", "set b",
+		"get a", "get b", "get c",
+		"delete a", "delete b",
+	}, keys)
+}
@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	context "context"
+
 	mock "github.com/stretchr/testify/mock"
 
 	store "github.com/eko/gocache/v2/store"
@@ -13,6 +15,20 @@ type Provider struct {
 	mock.Mock
 }
 
+// Close provides a mock function with given fields: ctx
+func (_m *Provider) Close(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Driver provides a mock function with given fields:
 func (_m *Provider) Driver() string {
 	ret := _m.Called()
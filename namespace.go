@@ -0,0 +1,199 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"fmt"
+	"github.com/eko/gocache/v2/store"
+	"strconv"
+	"strings"
+)
+
+// namespaceSeparator separates a namespace from the
+// key or tag it prefixes.
+const namespaceSeparator = ":"
+
+// PrefixClearer is implemented by stores that can remove
+// every key beginning with a prefix. It is used by Clear
+// when the Cache has a namespace.
+type PrefixClearer interface {
+	ClearPrefix(ctx context.Context, prefix string) error
+}
+
+// GenerationCounter is implemented by stores that cannot
+// list their keys to clear by prefix, such as Memcache.
+// Each namespace has a generation held within the store
+// that is included in every key within it, Clear moves the
+// namespace to a new generation so existing keys are no
+// longer read and expire on their own.
+type GenerationCounter interface {
+	// Generations returns the current generation of each
+	// namespace, in the same order as the namespaces
+	// passed.
+	Generations(ctx context.Context, namespaces []string) ([]uint64, error)
+
+	// IncrGeneration moves the namespace to a new
+	// generation.
+	IncrGeneration(ctx context.Context, namespace string) error
+}
+
+// WithNamespace prefixes every key and tag with the
+// namespace, and scopes Clear to only remove keys within
+// the namespace rather than flushing the store.
+func WithNamespace(namespace string) LoadOption {
+	return func(c *Cache) {
+		c.namespace = namespacePrefix(c.namespace, namespace)
+		c.namespaces = namespaceLevels(c.namespaces, c.namespace)
+	}
+}
+
+// WithNamespace returns a copy of the cache with keys and
+// tags prefixed by the namespace, sharing the same store
+// and configuration. Namespaces are nested when the cache
+// already has one.
+func (c *Cache) WithNamespace(namespace string) *Cache {
+	prefix := namespacePrefix(c.namespace, namespace)
+	return &Cache{
+		provider:        c.provider,
+		life:            c.life,
+		store:           c.store,
+		locks:           c.locks,
+		Driver:          c.Driver,
+		serializer:      c.serializer,
+		compression:     c.compression,
+		sealer:          c.sealer,
+		namespace:       prefix,
+		namespaces:      namespaceLevels(c.namespaces, prefix),
+		bus:             c.bus,
+		instrumentation: c.instrumentation,
+		middleware:      c.middleware,
+	}
+}
+
+// Namespace returns the prefix applied to every key and
+// tag, it is empty if the cache has no namespace.
+func (c *Cache) Namespace() string {
+	return c.namespace
+}
+
+// namespacePrefix appends a namespace and separator to
+// the existing prefix.
+func namespacePrefix(prefix, namespace string) string {
+	if namespace == "" {
+		return prefix
+	}
+	return prefix + namespace + namespaceSeparator
+}
+
+// namespaceLevels appends the prefix to the levels of a
+// nested namespace if it is a new level.
+func namespaceLevels(levels []string, prefix string) []string {
+	if prefix == "" || (len(levels) > 0 && levels[len(levels)-1] == prefix) {
+		return levels
+	}
+	return append(levels[:len(levels):len(levels)], prefix)
+}
+
+// key returns the key used within the store, prefixed
+// by the namespace.
+func (c *Cache) key(key interface{}) string {
+	return c.namespace + cacheKey(key)
+}
+
+// tags returns the tags prefixed by the namespace.
+func (c *Cache) tags(tags []string) []string {
+	if c.namespace == "" || len(tags) == 0 {
+		return tags
+	}
+	prefixed := make([]string, len(tags))
+	for i, tag := range tags {
+		prefixed[i] = c.namespace + tag
+	}
+	return prefixed
+}
+
+// lockKeys returns the store keys and tags to lock when
+// setting an item.
+func (c *Cache) lockKeys(key interface{}, tags []string) []interface{} {
+	return append(tagKeys(c.tags(tags)), c.key(key))
+}
+
+// storeOptions returns the Options with tags prefixed
+// by the namespace, the form used within the store.
+func (c *Cache) storeOptions(options Options) Options {
+	options.Tags = c.tags(options.Tags)
+	return options
+}
+
+// storeKeys returns the keys as they are held within a
+// store that implements GenerationCounter, with the
+// current generation following each level of the
+// namespace. Keys are returned unchanged for other stores.
+func (c *Cache) storeKeys(ctx context.Context, keys []string) ([]string, error) {
+	gc, ok := c.store.(GenerationCounter)
+	if !ok || len(c.namespaces) == 0 {
+		return keys, nil
+	}
+	gens, err := gc.Generations(ctx, c.namespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	level := ""
+	for i, namespace := range c.namespaces {
+		b.WriteString(namespace[len(level):])
+		b.WriteString(strconv.FormatUint(gens[i], 10))
+		b.WriteString(namespaceSeparator)
+		level = namespace
+	}
+	prefix := b.String()
+
+	mapped := make([]string, len(keys))
+	for i, key := range keys {
+		mapped[i] = key
+		if strings.HasPrefix(key, c.namespace) {
+			mapped[i] = prefix + key[len(c.namespace):]
+		}
+	}
+	return mapped, nil
+}
+
+// storeKey returns a single key as it is held within the
+// store, see storeKeys.
+func (c *Cache) storeKey(ctx context.Context, key string) (string, error) {
+	keys, err := c.storeKeys(ctx, []string{key})
+	if err != nil {
+		return "", err
+	}
+	return keys[0], nil
+}
+
+// invalidateOptions returns the InvalidateOptions with
+// tags prefixed by the namespace, the form used within
+// the store.
+func (c *Cache) invalidateOptions(options InvalidateOptions) InvalidateOptions {
+	options.Tags = c.tags(options.Tags)
+	return options
+}
+
+// clearNamespace removes all items in the namespace from the
+// store, or the entire store if there is no namespace.
+// ErrNamespaceClear is returned if the store can neither
+// clear by prefix nor move the namespace to a new
+// generation.
+func clearNamespace(ctx context.Context, s store.StoreInterface, namespace string) error {
+	if namespace == "" {
+		return s.Clear(ctx)
+	}
+	if pc, ok := s.(PrefixClearer); ok {
+		return pc.ClearPrefix(ctx, namespace)
+	}
+	if gc, ok := s.(GenerationCounter); ok {
+		return gc.IncrGeneration(ctx, namespace)
+	}
+	return fmt.Errorf("%w: the %s store implements neither PrefixClearer nor GenerationCounter", ErrNamespaceClear, s.GetType())
+}
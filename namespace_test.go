@@ -0,0 +1,105 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"fmt"
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/eko/gocache/v2/store"
+	"github.com/lacuna-seo/stash/internal/memcachetest"
+	"time"
+)
+
+func (t *StashTestSuite) TestNamespacePrefix() {
+	t.Equal("", namespacePrefix("", ""))
+	t.Equal("a:", namespacePrefix("", "a"))
+	t.Equal("a:b:", namespacePrefix("a:", "b"))
+	t.Equal("a:", namespacePrefix("a:", ""))
+}
+
+func (t *StashTestSuite) TestCache_WithNamespace() {
+	c, err := Load(NewMemory(time.Hour, time.Hour), WithNamespace("svc"))
+	t.NoError(err)
+	t.Equal("svc:", c.Namespace())
+	t.Equal("svc:key", c.key("key"))
+	t.Equal([]string{"svc:tag"}, c.tags([]string{"tag"}))
+
+	derived := c.WithNamespace("users")
+	t.Equal("svc:users:", derived.Namespace())
+	t.Equal(c.locks, derived.locks)
+	t.Equal(c.Driver, derived.Driver)
+}
+
+func (t *StashTestSuite) TestEscapeGlob() {
+	t.Equal(`svc\*\?\[a\]\\:`, escapeGlob(`svc*?[a]\:`))
+}
+
+func (t *StashTestSuite) TestNamespace_Generations() {
+	srv, err := memcachetest.New()
+	t.NoError(err)
+	defer srv.Close()
+	client := memcache.New(srv.Addr())
+
+	a, err := Load(NewMemcache([]string{srv.Addr()}, time.Hour), WithNamespace("svc"))
+	t.NoError(err)
+	b, err := Load(NewMemcache([]string{srv.Addr()}, time.Hour), WithNamespace("svc"))
+	t.NoError(err)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		t.NoError(a.Set(ctx, i, "a", Options{}))
+	}
+	t.NoError(a.SetMany(ctx, Item{Key: "many", Value: "a"}).Err())
+	found, err := b.Exists(ctx, 0, "many")
+	t.NoError(err)
+	t.Equal([]bool{true, true}, found)
+
+	// Keys include the generation rather than every key
+	// being added to a namespace tag.
+	gen, err := client.Get(memcacheGenerationPrefix + "svc:")
+	t.NoError(err)
+	_, err = client.Get("svc:" + string(gen.Value) + ":" + cacheKey(0))
+	t.NoError(err)
+	_, err = client.Get(fmt.Sprintf(store.MemcacheTagPattern, "svc:"))
+	t.ErrorIs(err, memcache.ErrCacheMiss)
+
+	// Clearing from one cache moves every cache sharing
+	// the store to the new generation.
+	t.NoError(a.Clear(ctx))
+	var got string
+	t.ErrorIs(b.Get(ctx, 0, &got), ErrNotFound)
+	t.ErrorIs(b.GetMany(ctx, "many")[0].Err, ErrNotFound)
+	t.NoError(b.Set(ctx, 0, "b", Options{}))
+	t.NoError(a.Get(ctx, 0, &got))
+	t.Equal("b", got)
+
+	// An evicted generation starts again from the current
+	// time rather than reusing an old generation.
+	t.NoError(client.Delete(memcacheGenerationPrefix + "svc:"))
+	t.ErrorIs(a.Get(ctx, 0, &got), ErrNotFound)
+	restarted, err := client.Get(memcacheGenerationPrefix + "svc:")
+	t.NoError(err)
+	t.Greater(string(restarted.Value), string(gen.Value))
+}
+
+func (t *StashTestSuite) TestNamespace_Unsupported() {
+	srv, err := memcachetest.New()
+	t.NoError(err)
+	defer srv.Close()
+
+	c, err := Load(NewChain(time.Minute, NewMemory(time.Hour, time.Hour), NewMemcache([]string{srv.Addr()}, time.Hour)), WithNamespace("svc"))
+	t.NoError(err)
+	ctx := context.Background()
+	t.NoError(c.Set(ctx, "key", "value", Options{}))
+
+	err = c.Clear(ctx)
+	t.ErrorIs(err, ErrNamespaceClear)
+	t.EqualError(err, "stash: store cannot clear a namespace: the memcache tier of the chain cannot clear by prefix")
+
+	// Nothing is removed from any tier.
+	var got string
+	t.NoError(c.Get(ctx, "key", &got))
+}
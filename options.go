@@ -18,6 +18,18 @@ type Options struct {
 	// Tags allows specifying associated tags to the
 	// current value.
 	Tags []string
+	// Grace keeps the item in the store for the duration
+	// after Expiration, during which it is served as
+	// stale. Remember returns stale items immediately and
+	// refreshes them in the background. Grace is ignored
+	// if Expiration is not set.
+	Grace time.Duration
+	// AbsentExpiration is the expiration time of the
+	// tombstone stored by SetAbsent, or by Remember when
+	// the loader returns ErrNotFound. Tombstones are
+	// typically kept for less time than values, Expiration
+	// is used if it is not set.
+	AbsentExpiration time.Duration
 }
 
 // InvalidateOptions represents the options for invalidating
@@ -41,3 +53,17 @@ func (o *Options) toStore() *store.Options {
 func (i *InvalidateOptions) toStore() store.InvalidateOptions {
 	return store.InvalidateOptions{Tags: i.Tags}
 }
+
+// LoadOption configures the Cache returned by Load.
+type LoadOption func(c *Cache)
+
+// WithSerializer sets the Serializer used to marshal and
+// unmarshal values, JSONSerializer is used by default.
+// Entries written by any of the built-in serializers
+// remain readable after switching. Load returns an error
+// if a custom Serializer's ID is reserved.
+func WithSerializer(s Serializer) LoadOption {
+	return func(c *Cache) {
+		c.serializer = s
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package prometheus provides a Prometheus collector for
+// the metrics reported by a stash Cache.
+package prometheus
+
+import (
+	"context"
+	"github.com/lacuna-seo/stash"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// labels are the labels applied to every metric.
+var labels = []string{"driver", "operation"}
+
+// Collector defines a stash.Instrumentation that records
+// the operations of a Cache as Prometheus metrics. It
+// implements prometheus.Collector so it can be registered
+// with any registry.
+//
+// Metrics are labelled by driver and operation:
+//   - stash_operations_total
+//   - stash_hits_total
+//   - stash_misses_total
+//   - stash_errors_total
+//   - stash_operation_duration_seconds
+//   - stash_payload_bytes
+type Collector struct {
+	operations *prometheus.CounterVec
+	hits       *prometheus.CounterVec
+	misses     *prometheus.CounterVec
+	errors     *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	size       *prometheus.HistogramVec
+}
+
+// NewCollector creates a new Collector, metric names are
+// prefixed with the namespace if it is not empty.
+func NewCollector(namespace string) *Collector {
+	counter := func(name, help string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "stash",
+			Name:      name,
+			Help:      help,
+		}, labels)
+	}
+	return &Collector{
+		operations: counter("operations_total", "The total number of cache operations."),
+		hits:       counter("hits_total", "The total number of keys found by cache lookups."),
+		misses:     counter("misses_total", "The total number of keys not found by cache lookups."),
+		errors:     counter("errors_total", "The total number of cache operations that returned an error."),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "stash",
+			Name:      "operation_duration_seconds",
+			Help:      "The time taken by cache operations.",
+			Buckets:   []float64{.0001, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, labels),
+		size: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "stash",
+			Name:      "payload_bytes",
+			Help:      "The size of values read from or written to the cache.",
+			Buckets:   prometheus.ExponentialBuckets(64, 4, 8),
+		}, labels),
+	}
+}
+
+// Observe records the event, it satisfies the
+// stash.Instrumentation interface.
+func (c *Collector) Observe(_ context.Context, e stash.Event) {
+	l := prometheus.Labels{"driver": e.Driver, "operation": e.Operation}
+	c.operations.With(l).Inc()
+	if e.Hits > 0 {
+		c.hits.With(l).Add(float64(e.Hits))
+	}
+	if e.Misses > 0 {
+		c.misses.With(l).Add(float64(e.Misses))
+	}
+	if e.Err != nil {
+		c.errors.With(l).Inc()
+	}
+	c.duration.With(l).Observe(e.Duration.Seconds())
+	if e.Size > 0 {
+		c.size.With(l).Observe(float64(e.Size))
+	}
+}
+
+// Describe sends the descriptors of the metrics to ch,
+// it satisfies the prometheus.Collector interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.collectors() {
+		m.Describe(ch)
+	}
+}
+
+// Collect sends the metrics to ch, it satisfies the
+// prometheus.Collector interface.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c.collectors() {
+		m.Collect(ch)
+	}
+}
+
+// collectors returns every metric within the Collector.
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.operations,
+		c.hits,
+		c.misses,
+		c.errors,
+		c.duration,
+		c.size,
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"github.com/lacuna-seo/stash"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCollector(t *testing.T) {
+	col := NewCollector("app")
+	reg := prometheus.NewRegistry()
+	assert.NoError(t, reg.Register(col))
+
+	c, err := stash.Load(stash.NewMemory(time.Hour, time.Hour), stash.WithInstrumentation(col))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	var got string
+	assert.NoError(t, c.Set(ctx, "key", "value", stash.Options{}))
+	assert.NoError(t, c.Get(ctx, "key", &got))
+	assert.ErrorIs(t, c.Get(ctx, "missing", &got), stash.ErrNotFound)
+	c.GetMany(ctx, "key", "missing")
+
+	get := prometheus.Labels{"driver": stash.MemoryDriver, "operation": stash.OperationGet}
+	assert.Equal(t, 2.0, testutil.ToFloat64(col.operations.With(get)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(col.hits.With(get)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(col.misses.With(get)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(col.errors.With(get)))
+
+	many := prometheus.Labels{"driver": stash.MemoryDriver, "operation": stash.OperationGetMany}
+	assert.Equal(t, 1.0, testutil.ToFloat64(col.operations.With(many)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(col.hits.With(many)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(col.misses.With(many)))
+
+	col.Observe(ctx, stash.Event{Driver: stash.RedisDriver, Operation: stash.OperationSet, Err: errors.New("error")})
+	set := prometheus.Labels{"driver": stash.RedisDriver, "operation": stash.OperationSet}
+	assert.Equal(t, 1.0, testutil.ToFloat64(col.errors.With(set)))
+
+	families, err := reg.Gather()
+	assert.NoError(t, err)
+	names := make([]string, len(families))
+	for i, f := range families {
+		names[i] = f.GetName()
+	}
+	assert.ElementsMatch(t, []string{
+		"app_stash_operations_total",
+		"app_stash_hits_total",
+		"app_stash_misses_total",
+		"app_stash_errors_total",
+		"app_stash_operation_duration_seconds",
+		"app_stash_payload_bytes",
+	}, names)
+}
@@ -5,6 +5,7 @@
 package stash
 
 import (
+	"context"
 	"github.com/eko/gocache/v2/store"
 )
 
@@ -20,6 +21,13 @@ type Provider interface {
 	Driver() string
 
 	// Store returns the interface for use within
-	// the cache.
+	// the cache. Keys passed to the store are always
+	// strings and the store must be safe for concurrent
+	// use.
 	Store() store.StoreInterface
+
+	// Close releases the resources owned by the
+	// provider, such as connection pools and background
+	// goroutines. It must be safe to call more than once.
+	Close(ctx context.Context) error
 }
@@ -7,18 +7,23 @@ package stash
 import (
 	"context"
 	"errors"
-	"github.com/eko/gocache/v2/cache"
+	"fmt"
 	"github.com/eko/gocache/v2/store"
 	"github.com/go-redis/redis/v8"
+	"strings"
 	"time"
 )
 
 // redisStore defines the data stored for the redisStore
 // client.
 type redisStore struct {
-	client            *redis.Client
+	client            redis.UniversalClient
 	options           redis.Options
 	defaultExpiration time.Duration
+	// owned is true when the client was created by the
+	// provider and should be closed with it.
+	owned  bool
+	closer closeOnce
 }
 
 // NewRedis creates a new redis store and returns a provider.
@@ -27,9 +32,104 @@ func NewRedis(options redis.Options, defaultExpiration time.Duration) Provider {
 		client:            redis.NewClient(&options),
 		options:           options,
 		defaultExpiration: defaultExpiration,
+		owned:             true,
+	}
+}
+
+// redisClientStore defines the data stored for a redis
+// store using an existing client.
+type redisClientStore struct {
+	*redisStore
+}
+
+// NewRedisClient creates a new redis store from an existing
+// client and returns a provider. The client can be a
+// *redis.Client, *redis.ClusterClient or any other
+// redis.UniversalClient, so connection pools configured
+// elsewhere (TLS, hooks) can be shared. The client is not
+// closed when the provider is. The Driver is RedisDriver.
+func NewRedisClient(client redis.UniversalClient, defaultExpiration time.Duration) Provider {
+	return &redisClientStore{
+		redisStore: &redisStore{
+			client:            client,
+			defaultExpiration: defaultExpiration,
+		},
+	}
+}
+
+// Validate satisfies the Provider interface by checking
+// the client is not nil.
+func (r *redisClientStore) Validate() error {
+	if r.client == nil {
+		return errors.New("error: no redis client defined")
+	}
+	return nil
+}
+
+// redisFailoverStore defines the data stored for a
+// Sentinel managed failover group.
+type redisFailoverStore struct {
+	*redisStore
+	options redis.FailoverOptions
+}
+
+// NewRedisFailover creates a new redis store backed by a
+// Sentinel managed failover group and returns a provider.
+// The Driver is RedisDriver.
+func NewRedisFailover(options redis.FailoverOptions, defaultExpiration time.Duration) Provider {
+	return &redisFailoverStore{
+		redisStore: &redisStore{
+			client:            redis.NewFailoverClient(&options),
+			defaultExpiration: defaultExpiration,
+			owned:             true,
+		},
+		options: options,
+	}
+}
+
+// Validate satisfies the Provider interface by checking
+// the master name and sentinel addresses are defined.
+func (r *redisFailoverStore) Validate() error {
+	if r.options.MasterName == "" {
+		return errors.New("error: no redis master name defined")
+	}
+	if len(r.options.SentinelAddrs) == 0 {
+		return errors.New("error: no redis sentinel addresses defined")
+	}
+	return nil
+}
+
+// redisClusterStore defines the data stored for a Redis
+// Cluster.
+type redisClusterStore struct {
+	*redisStore
+	options redis.ClusterOptions
+}
+
+// NewRedisCluster creates a new redis store backed by a
+// Redis Cluster and returns a provider. Batch operations
+// and clearing are split by node, as multi key commands
+// cannot span hash slots. The Driver is RedisDriver.
+func NewRedisCluster(options redis.ClusterOptions, defaultExpiration time.Duration) Provider {
+	return &redisClusterStore{
+		redisStore: &redisStore{
+			client:            redis.NewClusterClient(&options),
+			defaultExpiration: defaultExpiration,
+			owned:             true,
+		},
+		options: options,
 	}
 }
 
+// Validate satisfies the Provider interface by checking
+// the cluster addresses are defined.
+func (r *redisClusterStore) Validate() error {
+	if len(r.options.Addrs) == 0 {
+		return errors.New("error: no redis cluster addresses defined")
+	}
+	return nil
+}
+
 // Validate satisfies the Provider interface by checking
 // for environment variables.
 func (r *redisStore) Validate() error {
@@ -48,9 +148,12 @@ func (r *redisStore) Driver() string {
 // Store satisfies the Provider interface by creating a
 // new store.StoreInterface.
 func (r *redisStore) Store() store.StoreInterface {
-	return cache.New(store.NewRedis(r.client, &store.Options{
-		Expiration: r.defaultExpiration,
-	}))
+	return &redisExtendedStore{
+		RedisStore: store.NewRedis(r.client, &store.Options{
+			Expiration: r.defaultExpiration,
+		}),
+		client: r.client,
+	}
 }
 
 // Ping satisfies the Provider interface by pinging the
@@ -58,3 +161,309 @@ func (r *redisStore) Store() store.StoreInterface {
 func (r *redisStore) Ping() error {
 	return r.client.Ping(context.Background()).Err()
 }
+
+// Close satisfies the Provider interface by closing the
+// client if it was created by the provider.
+func (r *redisStore) Close(_ context.Context) error {
+	if !r.owned {
+		return nil
+	}
+	return r.closer.close(r.client.Close)
+}
+
+// redisTagExpiration is the expiration of the sets used
+// to store tags, matching gocache's redis store.
+const redisTagExpiration = 720 * time.Hour
+
+// redisExtendedStore extends the gocache redis store with
+// batch operations using MGET and pipelining, clearing
+// keys by prefix and resolving tags.
+type redisExtendedStore struct {
+	*store.RedisStore
+	client redis.UniversalClient
+}
+
+// cluster returns the cluster client if the store is
+// backed by a Redis Cluster.
+func (r *redisExtendedStore) cluster() (*redis.ClusterClient, bool) {
+	cc, ok := r.client.(*redis.ClusterClient)
+	return cc, ok
+}
+
+// Clear satisfies the store.StoreInterface by flushing
+// the database, or every master of a Redis Cluster.
+func (r *redisExtendedStore) Clear(ctx context.Context) error {
+	cc, ok := r.cluster()
+	if !ok {
+		return r.RedisStore.Clear(ctx)
+	}
+	return cc.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+		return client.FlushAll(ctx).Err()
+	})
+}
+
+// GetMany satisfies the BatchGetter interface by
+// retrieving all keys with a single MGET.
+func (r *redisExtendedStore) GetMany(ctx context.Context, keys []string) ([]interface{}, []error) {
+	values := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	if len(keys) == 0 {
+		return values, errs
+	}
+
+	if _, ok := r.cluster(); ok {
+		cmds := make([]*redis.StringCmd, len(keys))
+		_, _ = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range keys {
+				cmds[i] = pipe.Get(ctx, key)
+			}
+			return nil
+		})
+		for i, cmd := range cmds {
+			values[i], errs[i] = cmd.Val(), cmd.Err()
+		}
+		return values, errs
+	}
+
+	result, err := r.client.MGet(ctx, keys...).Result()
+	for i := range keys {
+		switch {
+		case err != nil:
+			errs[i] = err
+		case result[i] == nil:
+			errs[i] = redis.Nil
+		default:
+			values[i] = result[i]
+		}
+	}
+
+	return values, errs
+}
+
+// Exists satisfies the ExistenceChecker interface by
+// pipelining an EXISTS for each key, EXISTS with multiple
+// keys only returns the amount found.
+func (r *redisExtendedStore) Exists(ctx context.Context, keys []string) ([]bool, error) {
+	found := make([]bool, len(keys))
+	if len(keys) == 0 {
+		return found, nil
+	}
+	cmds := make([]*redis.IntCmd, len(keys))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Exists(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, cmd := range cmds {
+		found[i] = cmd.Val() > 0
+	}
+	return found, nil
+}
+
+// redisExpiration maps an expiration to the value passed
+// to go-redis. Negative expirations keep the item forever,
+// but go-redis sends them as KEEPTTL which would keep the
+// TTL of an existing item instead of removing it.
+func redisExpiration(expiration time.Duration) time.Duration {
+	if expiration < 0 {
+		return 0
+	}
+	return expiration
+}
+
+// Set satisfies the store.StoreInterface by storing the
+// item with the gocache redis store, removing any existing
+// TTL for items kept forever.
+func (r *redisExtendedStore) Set(ctx context.Context, key interface{}, value interface{}, options *store.Options) error {
+	if options != nil && options.Expiration < 0 {
+		o := *options
+		o.Expiration = redisExpiration(o.Expiration)
+		options = &o
+	}
+	return r.RedisStore.Set(ctx, key, value, options)
+}
+
+// Add satisfies the ConditionalSetter interface using
+// SET NX, tags are added once the item is stored.
+func (r *redisExtendedStore) Add(ctx context.Context, key string, value []byte, options *store.Options) error {
+	return r.setIf(ctx, key, value, options, false)
+}
+
+// Replace satisfies the ConditionalSetter interface using
+// SET XX, tags are added once the item is stored.
+func (r *redisExtendedStore) Replace(ctx context.Context, key string, value []byte, options *store.Options) error {
+	return r.setIf(ctx, key, value, options, true)
+}
+
+// setIf stores the item with SET XX if replace is true,
+// or SET NX otherwise, followed by its tags.
+func (r *redisExtendedStore) setIf(ctx context.Context, key string, value []byte, options *store.Options, replace bool) error {
+	var expiration time.Duration
+	if options != nil && options.Expiration > 0 {
+		expiration = options.Expiration
+	}
+
+	var stored bool
+	var err error
+	if replace {
+		stored, err = r.client.SetXX(ctx, key, value, expiration).Result()
+	} else {
+		stored, err = r.client.SetNX(ctx, key, value, expiration).Result()
+	}
+	switch {
+	case err != nil:
+		return err
+	case !stored && replace:
+		return ErrNotFound
+	case !stored:
+		return ErrKeyExists
+	}
+
+	if options == nil || len(options.Tags) == 0 {
+		return nil
+	}
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, tag := range options.Tags {
+			tagKey := fmt.Sprintf(store.RedisTagPattern, tag)
+			pipe.SAdd(ctx, tagKey, key)
+			pipe.Expire(ctx, tagKey, redisTagExpiration)
+		}
+		return nil
+	})
+	return err
+}
+
+// SetMany satisfies the BatchSetter interface by storing
+// all items and their tags in a single pipeline.
+func (r *redisExtendedStore) SetMany(ctx context.Context, items []BatchItem) []error {
+	errs := make([]error, len(items))
+	if len(items) == 0 {
+		return errs
+	}
+
+	cmds := make([]*redis.StatusCmd, len(items))
+	_, _ = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, item := range items {
+			cmds[i] = pipe.Set(ctx, item.Key, item.Value, redisExpiration(item.Options.Expiration))
+			for _, tag := range item.Options.Tags {
+				tagKey := fmt.Sprintf(store.RedisTagPattern, tag)
+				pipe.SAdd(ctx, tagKey, item.Key)
+				pipe.Expire(ctx, tagKey, redisTagExpiration)
+			}
+		}
+		return nil
+	})
+
+	for i, cmd := range cmds {
+		errs[i] = cmd.Err()
+	}
+
+	return errs
+}
+
+// DeleteMany satisfies the BatchDeleter interface by
+// removing all keys with a single DEL, or a pipeline of
+// DELs for a Redis Cluster.
+func (r *redisExtendedStore) DeleteMany(ctx context.Context, keys []string) []error {
+	errs := make([]error, len(keys))
+	if len(keys) == 0 {
+		return errs
+	}
+
+	if _, ok := r.cluster(); ok {
+		cmds := make([]*redis.IntCmd, len(keys))
+		_, _ = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range keys {
+				cmds[i] = pipe.Del(ctx, key)
+			}
+			return nil
+		})
+		for i, cmd := range cmds {
+			errs[i] = cmd.Err()
+		}
+		return errs
+	}
+
+	err := r.client.Del(ctx, keys...).Err()
+	for i := range errs {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// redisScanCount is the amount of keys requested per SCAN
+// when clearing by prefix.
+const redisScanCount = 1000
+
+// ClearPrefix satisfies the PrefixClearer interface by
+// scanning for keys that begin with the prefix and
+// deleting them in batches. Every master of a Redis
+// Cluster is scanned.
+func (r *redisExtendedStore) ClearPrefix(ctx context.Context, prefix string) error {
+	cc, ok := r.cluster()
+	if !ok {
+		return clearPrefix(ctx, r.client, prefix, false)
+	}
+	return cc.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+		return clearPrefix(ctx, client, prefix, true)
+	})
+}
+
+// clearPrefix scans a single node for keys that begin
+// with the prefix and deletes them. Keys are deleted one
+// at a time within a pipeline when split is true, as the
+// keys of a cluster node may belong to different slots.
+func clearPrefix(ctx context.Context, client redis.Cmdable, prefix string, split bool) error {
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(ctx, cursor, escapeGlob(prefix)+"*", redisScanCount).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 && split {
+			_, err = client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for _, key := range keys {
+					pipe.Del(ctx, key)
+				}
+				return nil
+			})
+		} else if len(keys) > 0 {
+			err = client.Del(ctx, keys...).Err()
+		}
+		if err != nil {
+			return err
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// escapeGlob escapes the special characters used by the
+// Redis SCAN MATCH pattern.
+func escapeGlob(s string) string {
+	return globReplacer.Replace(s)
+}
+
+// globReplacer escapes Redis glob characters.
+var globReplacer = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// TagKeys satisfies the TagResolver interface by reading
+// the members of each tag's set.
+func (r *redisExtendedStore) TagKeys(ctx context.Context, tags []string) ([]string, error) {
+	var keys []string
+	for _, tag := range tags {
+		members, err := r.client.SMembers(ctx, fmt.Sprintf(store.RedisTagPattern, tag)).Result()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, members...)
+	}
+	return keys, nil
+}
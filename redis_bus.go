@@ -0,0 +1,105 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"sync"
+)
+
+// DefaultInvalidationChannel is the Redis channel used
+// by NewRedisBus when no channel is passed.
+const DefaultInvalidationChannel = "stash:invalidations"
+
+// redisBus defines the data stored for an InvalidationBus
+// using Redis pub/sub.
+type redisBus struct {
+	client  redis.UniversalClient
+	channel string
+	mtx     sync.Mutex
+	subs    []*redis.PubSub
+	wg      sync.WaitGroup
+}
+
+// NewRedisBus creates a new InvalidationBus that
+// broadcasts invalidations over Redis pub/sub on the
+// channel passed, DefaultInvalidationChannel is used if
+// the channel is empty. The client is not closed when
+// the bus is closed.
+func NewRedisBus(client redis.UniversalClient, channel string) InvalidationBus {
+	if channel == "" {
+		channel = DefaultInvalidationChannel
+	}
+	return &redisBus{
+		client:  client,
+		channel: channel,
+	}
+}
+
+// Publish satisfies the InvalidationBus interface by
+// publishing the JSON encoded invalidation to the
+// channel.
+func (r *redisBus) Publish(ctx context.Context, msg Invalidation) error {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, r.channel, buf).Err()
+}
+
+// Subscribe satisfies the InvalidationBus interface by
+// subscribing to the channel and calling fn for every
+// message received. Messages that cannot be decoded are
+// ignored.
+func (r *redisBus) Subscribe(ctx context.Context, fn func(msg Invalidation)) error {
+	sub := r.client.Subscribe(ctx, r.channel)
+	_, err := sub.Receive(ctx)
+	if err != nil {
+		_ = sub.Close()
+		return err
+	}
+
+	r.mtx.Lock()
+	r.subs = append(r.subs, sub)
+	r.mtx.Unlock()
+
+	ch := sub.Channel()
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for m := range ch {
+			var msg Invalidation
+			if json.Unmarshal([]byte(m.Payload), &msg) != nil {
+				continue
+			}
+			fn(msg)
+		}
+	}()
+
+	return nil
+}
+
+// Close satisfies the InvalidationBus interface by
+// closing every subscription and waiting for their
+// handlers to return.
+func (r *redisBus) Close() error {
+	r.mtx.Lock()
+	subs := r.subs
+	r.subs = nil
+	r.mtx.Unlock()
+
+	var first error
+	for _, sub := range subs {
+		err := sub.Close()
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	r.wg.Wait()
+
+	return first
+}
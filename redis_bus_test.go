@@ -0,0 +1,73 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+func (t *StashTestSuite) TestRedisBus() {
+	mr := miniredis.RunT(t.T())
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	shared := NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour)
+	l1a, l1b := NewMemory(time.Hour, time.Hour), NewMemory(time.Hour, time.Hour)
+
+	busA, busB := NewRedisBus(client, ""), NewRedisBus(client, "")
+	defer busA.Close()
+	defer busB.Close()
+
+	a, err := Load(NewChain(time.Minute, l1a, shared), WithInvalidationBus(busA, l1a))
+	t.NoError(err)
+	b, err := Load(NewChain(time.Minute, l1b, shared), WithInvalidationBus(busB, l1b))
+	t.NoError(err)
+
+	local, err := Load(l1b)
+	t.NoError(err)
+
+	ctx := context.Background()
+	t.NoError(a.Set(ctx, "key", "stash", Options{Tags: []string{"tag"}}))
+
+	var got string
+	t.NoError(b.Get(ctx, "key", &got))
+	t.NoError(local.Get(ctx, "key", &got))
+
+	t.NoError(a.Invalidate(ctx, InvalidateOptions{Tags: []string{"tag"}}))
+	t.Eventually(func() bool {
+		return local.Get(ctx, "key", &got) == ErrNotFound
+	}, time.Second, time.Millisecond*10)
+
+	t.NoError(b.Set(ctx, "key", "stash", Options{}))
+	t.NoError(a.Delete(ctx, "key"))
+	t.Eventually(func() bool {
+		return local.Get(ctx, "key", &got) == ErrNotFound
+	}, time.Second, time.Millisecond*10)
+}
+
+func (t *StashTestSuite) TestRedisBus_Errors() {
+	mr := miniredis.RunT(t.T())
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	bus := NewRedisBus(client, "channel")
+	t.NoError(bus.Publish(context.Background(), Invalidation{}))
+
+	// Invalid payloads are ignored.
+	called := make(chan Invalidation, 1)
+	t.NoError(bus.Subscribe(context.Background(), func(msg Invalidation) {
+		called <- msg
+	}))
+	mr.Publish("channel", "invalid")
+	t.NoError(bus.Publish(context.Background(), Invalidation{Source: "source"}))
+	t.Equal("source", (<-called).Source)
+	t.NoError(bus.Close())
+
+	mr.Close()
+	t.Error(bus.Subscribe(context.Background(), func(msg Invalidation) {}))
+}
@@ -5,7 +5,12 @@
 package stash
 
 import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
 	"github.com/go-redis/redis/v8"
+	"net"
+	"strings"
 	"time"
 )
 
@@ -25,3 +30,147 @@ func (t *StashTestSuite) TestRedis() {
 		options: redis.Options{},
 	})
 }
+
+func (t *StashTestSuite) TestRedis_TTL() {
+	mr := miniredis.RunT(t.T())
+	c, err := Load(NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour))
+	t.NoError(err)
+
+	ctx := context.Background()
+	t.NoError(c.Set(ctx, "expiring", "stash", Options{Expiration: time.Minute}))
+	t.NoError(c.Set(ctx, "forever", "stash", Options{}))
+
+	var got string
+	ttl, err := c.GetWithTTL(ctx, "expiring", &got)
+	t.NoError(err)
+	t.Equal("stash", got)
+	t.Equal(time.Minute, ttl)
+
+	ttl, err = c.TTL(ctx, "forever")
+	t.NoError(err)
+	t.Equal(NoExpiration, ttl)
+
+	_, err = c.TTL(ctx, "missing")
+	t.ErrorIs(err, ErrNotFound)
+}
+
+func (t *StashTestSuite) TestRedisFailover() {
+	got := NewRedisFailover(redis.FailoverOptions{}, time.Second)
+	t.NotNil(got)
+	t.Equal(RedisDriver, got.Driver())
+	t.EqualError(got.Validate(), "error: no redis master name defined")
+
+	got = NewRedisFailover(redis.FailoverOptions{MasterName: "master"}, time.Second)
+	t.EqualError(got.Validate(), "error: no redis sentinel addresses defined")
+
+	// A second server acts as the sentinel, reporting the
+	// first as the master.
+	master := miniredis.RunT(t.T())
+	sentinel := miniredis.RunT(t.T())
+	host, port, err := net.SplitHostPort(master.Addr())
+	t.NoError(err)
+	t.NoError(sentinel.Server().Register("SENTINEL", func(c *server.Peer, cmd string, args []string) {
+		switch strings.ToLower(args[0]) {
+		case "get-master-addr-by-name":
+			c.WriteStrings([]string{host, port})
+		default:
+			c.WriteLen(0)
+		}
+	}))
+
+	c, err := Load(NewRedisFailover(redis.FailoverOptions{
+		MasterName:    "master",
+		SentinelAddrs: []string{sentinel.Addr()},
+	}, time.Hour))
+	t.NoError(err)
+
+	ctx := context.Background()
+	t.NoError(c.Set(ctx, "key", "value", Options{Tags: []string{"tag"}}))
+	t.True(master.Exists("key"))
+
+	var value string
+	t.NoError(c.Get(ctx, "key", &value))
+	t.Equal("value", value)
+	t.NoError(c.Invalidate(ctx, InvalidateOptions{Tags: []string{"tag"}}))
+	t.False(master.Exists("key"))
+}
+
+func (t *StashTestSuite) TestRedisCluster() {
+	got := NewRedisCluster(redis.ClusterOptions{}, time.Second)
+	t.NotNil(got)
+	t.Equal(RedisDriver, got.Driver())
+	t.EqualError(got.Validate(), "error: no redis cluster addresses defined")
+
+	mr := miniredis.RunT(t.T())
+	c, err := Load(NewRedisCluster(redis.ClusterOptions{Addrs: []string{mr.Addr()}}, time.Hour))
+	t.NoError(err)
+
+	ctx := context.Background()
+	t.NoError(c.SetMany(ctx,
+		Item{Key: "a", Value: "a", Options: Options{Tags: []string{"tag"}}},
+		Item{Key: "b", Value: "b"},
+	).Err())
+
+	results := c.GetMany(ctx, "a", "b", "missing")
+	var value string
+	t.NoError(results[0].Decode(&value))
+	t.Equal("a", value)
+	t.NoError(results[1].Decode(&value))
+	t.Equal("b", value)
+	t.ErrorIs(results[2].Err, ErrNotFound)
+
+	t.NoError(c.Invalidate(ctx, InvalidateOptions{Tags: []string{"tag"}}))
+	t.False(mr.Exists("a"))
+
+	t.NoError(c.DeleteMany(ctx, "b").Err())
+	t.False(mr.Exists("b"))
+
+	ns := c.WithNamespace("ns")
+	t.NoError(ns.Set(ctx, "key", "value", Options{}))
+	t.NoError(c.Set(ctx, "key", "value", Options{}))
+	t.NoError(ns.Clear(ctx))
+	t.False(mr.Exists("ns:key"))
+	t.True(mr.Exists("key"))
+
+	t.NoError(c.Clear(ctx))
+	t.False(mr.Exists("key"))
+}
+
+func (t *StashTestSuite) TestRedisClient() {
+	t.EqualError(NewRedisClient(nil, time.Second).Validate(), "error: no redis client defined")
+
+	mr := miniredis.RunT(t.T())
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	c, err := Load(NewRedisClient(client, time.Hour))
+	t.NoError(err)
+	t.Equal(RedisDriver, c.Driver)
+
+	ctx := context.Background()
+	t.NoError(c.Set(ctx, "key", "stash", Options{}))
+	t.NoError(c.Close(ctx))
+
+	// The client was passed in, so it is left open.
+	t.NoError(client.Ping(ctx).Err())
+	t.ErrorIs(c.Get(ctx, "key", new(string)), ErrClosed)
+
+	c, err = Load(NewRedisClient(client, time.Hour))
+	t.NoError(err)
+	var got string
+	t.NoError(c.Get(ctx, "key", &got))
+	t.Equal("stash", got)
+}
+
+func (t *StashTestSuite) TestRedis_Close() {
+	mr := miniredis.RunT(t.T())
+	prov := NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour)
+	c, err := Load(prov)
+	t.NoError(err)
+
+	ctx := context.Background()
+	t.NoError(c.Close(ctx))
+	t.NoError(c.Close(ctx))
+	t.ErrorIs(c.Set(ctx, "key", "stash", Options{}), ErrClosed)
+	t.Error(prov.Ping())
+}
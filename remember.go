@@ -0,0 +1,120 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"errors"
+)
+
+// Remember retrieves an item from the cache by key, if the
+// item does not exist the loader is called and the result
+// is stored with the options passed before being
+// unmarshalled into v.
+//
+// Concurrent calls for the same key within the process
+// share a single call to the loader, preventing a
+// stampede on the source when the item is missing. The
+// shared call is passed the values of the first caller's
+// context but not its cancellation, a caller whose context
+// is cancelled returns its error while the loader carries
+// on for the others. It is cancelled when the cache is
+// closed. Pass RememberForever as the Expiration to keep
+// the item indefinitely.
+//
+// If the options have a Grace period, items past their
+// Expiration are returned immediately while a single
+// background call to the loader refreshes them.
+//
+// If the options have an AbsentExpiration and the loader
+// returns an error wrapping ErrNotFound, a tombstone is
+// stored and ErrAbsent is returned, subsequent calls
+// return ErrAbsent without calling the loader until the
+// tombstone expires.
+func (c *Cache) Remember(ctx context.Context, key, v interface{}, options Options, loader func(ctx context.Context) (interface{}, error)) error {
+	if err := c.life.acquire(); err != nil {
+		return err
+	}
+	defer c.life.release()
+	k := c.key(key)
+	ctx, start := c.start(ctx, OperationRemember)
+	call, stale, err := c.get(ctx, k, v)
+	if err == nil || !errors.Is(err, ErrNotFound) {
+		if err == nil && stale {
+			c.refresh(key, options, loader)
+		}
+		c.observeLookup(ctx, start, OperationRemember, k, len(call.Value), err)
+		return err
+	}
+
+	var result interface{}
+	select {
+	case r := <-c.group.DoChan(k, func() (interface{}, error) {
+		if err := c.life.acquire(); err != nil {
+			return nil, err
+		}
+		defer c.life.release()
+		return c.load(detach(ctx, c.life.ctx), key, options, loader)
+	}):
+		result, err = r.Val, r.Err
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = c.unmarshal(toBytes(result), v)
+	}
+
+	e := Event{Operation: OperationRemember, Keys: []string{k}, Misses: 1, Size: payloadSize(result), Err: err}
+	if errors.Is(err, ErrAbsent) {
+		e.Err = nil
+	}
+	c.observe(ctx, start, e)
+
+	return err
+}
+
+// detachedContext carries the values of a caller's
+// context without its deadline or cancellation, which are
+// taken from the cache's lifecycle context instead.
+type detachedContext struct {
+	context.Context
+	values context.Context
+}
+
+// detach returns a context with the values of ctx that is
+// only cancelled when lifetime is.
+func detach(ctx, lifetime context.Context) context.Context {
+	return detachedContext{Context: lifetime, values: ctx}
+}
+
+// Value returns the value of the caller's context.
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.values.Value(key)
+}
+
+// load calls the loader and stores the result, returning
+// the marshalled value.
+func (c *Cache) load(ctx context.Context, key interface{}, options Options, loader func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	value, err := loader(ctx)
+	if errors.Is(err, ErrNotFound) && options.AbsentExpiration != 0 {
+		err = c.set(ctx, key, []byte{tombstoneHeader}, absentOptions(options))
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrAbsent
+	}
+	if err != nil {
+		return nil, err
+	}
+	marshal, err := c.marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	err = c.set(ctx, key, marshal, options)
+	if err != nil {
+		return nil, err
+	}
+	return marshal, nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"errors"
+	"github.com/lacuna-seo/stash/mocks"
+	"github.com/stretchr/testify/mock"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func (t *StashTestSuite) TestStash_Remember() {
+	tt := map[string]struct {
+		mock   func(m *mocks.StoreInterface)
+		loader func(ctx context.Context) (interface{}, error)
+		want   interface{}
+	}{
+		"Hit": {
+			func(m *mocks.StoreInterface) {
+				m.On("Get", mock.Anything, mock.Anything).
+					Return("\"cached\"", nil)
+			},
+			nil,
+			"cached",
+		},
+		"Miss": {
+			func(m *mocks.StoreInterface) {
+				m.On("Get", mock.Anything, mock.Anything).
+					Return(nil, errors.New(goCacheNotFound))
+				m.On("Set", mock.Anything, CacheKey, append([]byte{JSONSerializerID}, "\"loaded\""...), mock.Anything).
+					Return(nil)
+			},
+			func(ctx context.Context) (interface{}, error) {
+				return "loaded", nil
+			},
+			"loaded",
+		},
+		"Get Error": {
+			func(m *mocks.StoreInterface) {
+				m.On("Get", mock.Anything, mock.Anything).
+					Return(nil, errors.New("get error"))
+			},
+			nil,
+			"get error",
+		},
+		"Loader Error": {
+			func(m *mocks.StoreInterface) {
+				m.On("Get", mock.Anything, mock.Anything).
+					Return(nil, errors.New(goCacheNotFound))
+			},
+			func(ctx context.Context) (interface{}, error) {
+				return nil, errors.New("loader error")
+			},
+			"loader error",
+		},
+		"Marshal Error": {
+			func(m *mocks.StoreInterface) {
+				m.On("Get", mock.Anything, mock.Anything).
+					Return(nil, errors.New(goCacheNotFound))
+			},
+			func(ctx context.Context) (interface{}, error) {
+				return make(chan bool), nil
+			},
+			"json: unsupported type",
+		},
+		"Set Error": {
+			func(m *mocks.StoreInterface) {
+				m.On("Get", mock.Anything, mock.Anything).
+					Return(nil, errors.New(goCacheNotFound))
+				m.On("Set", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+					Return(errors.New("set error"))
+			},
+			func(ctx context.Context) (interface{}, error) {
+				return "loaded", nil
+			},
+			"set error",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func() {
+			c := t.Setup(test.mock)
+			var got string
+			err := c.Remember(context.Background(), CacheKey, &got, Options{}, test.loader)
+			if err != nil {
+				t.Contains(err.Error(), test.want)
+				return
+			}
+			t.Equal(test.want, got)
+		})
+	}
+}
+
+func (t *StashTestSuite) TestStash_Remember_Singleflight() {
+	c, err := Load(NewMemory(time.Hour, time.Hour))
+	t.NoError(err)
+
+	var (
+		wg    sync.WaitGroup
+		calls int32
+		start = make(chan struct{})
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			var got int
+			err := c.Remember(context.Background(), CacheKey, &got, Options{}, func(ctx context.Context) (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(time.Millisecond * 50)
+				return 10, nil
+			})
+			t.NoError(err)
+			t.Equal(10, got)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	t.Equal(int32(1), atomic.LoadInt32(&calls))
+}
+
+func (t *StashTestSuite) TestStash_Remember_Cancel() {
+	c, err := Load(NewMemory(time.Hour, time.Hour))
+	t.NoError(err)
+
+	type ctxKey struct{}
+	var calls int32
+	started, release := make(chan struct{}), make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		close(started)
+		<-release
+		if ctx.Value(ctxKey{}) != "first" {
+			return nil, errors.New("missing context value")
+		}
+		return 10, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "first"))
+	first := make(chan error)
+	go func() {
+		var got int
+		first <- c.Remember(ctx, CacheKey, &got, Options{}, loader)
+	}()
+	<-started
+
+	second := make(chan error)
+	var got int
+	go func() {
+		second <- c.Remember(context.Background(), CacheKey, &got, Options{}, loader)
+	}()
+	time.Sleep(time.Millisecond * 20)
+
+	// The first caller returns once cancelled, the loader
+	// carries on for the second.
+	cancel()
+	t.ErrorIs(<-first, context.Canceled)
+	close(release)
+	t.NoError(<-second)
+	t.Equal(10, got)
+	t.Equal(int32(1), atomic.LoadInt32(&calls))
+}
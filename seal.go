@@ -0,0 +1,205 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// encryptedHeader prefixes values sealed with AES-GCM
+	// by WithEncryption.
+	encryptedHeader byte = 0x1a
+	// signedHeader prefixes values signed with HMAC-SHA256
+	// by WithIntegrity.
+	signedHeader byte = 0x1b
+)
+
+// ErrIntegrity is returned by Get when a value cannot be
+// decrypted or its signature does not match, for example
+// if it has been tampered with or the key used to seal it
+// is no longer in the Keyring.
+var ErrIntegrity = errors.New("stash: value failed integrity check")
+
+// Keyring defines the keys used to seal values with
+// WithEncryption or WithIntegrity. Values are sealed with
+// the primary key and its ID is stored alongside them, so
+// keys can be rotated by adding a new primary key while
+// keeping the old ones to read existing values.
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// NewKeyring creates a new Keyring from keys by ID, new
+// values are sealed with the key of the primary ID. Keys
+// must be 16, 24 or 32 bytes long (AES-128, AES-192 or
+// AES-256) and IDs at most 255 bytes.
+func NewKeyring(primary string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("stash: primary key %q not in keyring", primary)
+	}
+	k := &Keyring{
+		primary: primary,
+		keys:    make(map[string][]byte, len(keys)),
+	}
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("stash: invalid key id %q", id)
+		}
+		switch len(key) {
+		case 16, 24, 32:
+		default:
+			return nil, fmt.Errorf("stash: invalid key size %d for key %q", len(key), id)
+		}
+		k.keys[id] = append([]byte(nil), key...)
+	}
+	return k, nil
+}
+
+// WithEncryption encrypts values with AES-GCM before they
+// are stored and decrypts them once retrieved. Values
+// stored without encryption are treated as a miss. Load
+// returns an error if the Keyring is nil.
+func WithEncryption(k *Keyring) LoadOption {
+	return func(c *Cache) {
+		c.sealer = &sealer{keyring: k, encrypt: true}
+	}
+}
+
+// WithIntegrity signs values with HMAC-SHA256 before they
+// are stored and verifies them once retrieved, without
+// encrypting them. Values stored without a signature are
+// treated as a miss. Load returns an error if the Keyring
+// is nil.
+func WithIntegrity(k *Keyring) LoadOption {
+	return func(c *Cache) {
+		c.sealer = &sealer{keyring: k}
+	}
+}
+
+// sealer encrypts or signs values with a Keyring.
+type sealer struct {
+	keyring *Keyring
+	encrypt bool
+}
+
+// seal encrypts or signs the data stored under the key
+// with the primary key. The sealed value is the header,
+// the length of the key ID, the key ID and either the
+// nonce and ciphertext or the signature and data. The
+// header, key ID and store key are authenticated along
+// with the data, so a sealed value cannot be copied to
+// another key.
+func (s *sealer) seal(key string, data []byte) ([]byte, error) {
+	id := s.keyring.primary
+	secret := s.keyring.keys[id]
+
+	header := signedHeader
+	if s.encrypt {
+		header = encryptedHeader
+	}
+	buf := make([]byte, 0, 2+len(id)+len(data)+sha256.Size)
+	buf = append(buf, header, byte(len(id)))
+	buf = append(buf, id...)
+
+	ad := additionalData(buf, key)
+
+	if !s.encrypt {
+		buf = append(buf, sign(secret, ad, data)...)
+		return append(buf, data...), nil
+	}
+
+	aead, err := newAEAD(secret)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf, nonce...)
+	return aead.Seal(buf, nonce, data, ad), nil
+}
+
+// open decrypts or verifies a value sealed under the key,
+// returning ErrIntegrity if it cannot be.
+func (s *sealer) open(key string, buf []byte) ([]byte, error) {
+	if len(buf) < 2 || len(buf) < 2+int(buf[1]) {
+		return nil, ErrIntegrity
+	}
+	header, id := buf[0], string(buf[2:2+int(buf[1])])
+	body := buf[2+len(id):]
+
+	secret, ok := s.keyring.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrIntegrity, id)
+	}
+	ad := additionalData(buf[:2+len(id)], key)
+
+	if header == signedHeader {
+		if len(body) < sha256.Size || !hmac.Equal(body[:sha256.Size], sign(secret, ad, body[sha256.Size:])) {
+			return nil, ErrIntegrity
+		}
+		return body[sha256.Size:], nil
+	}
+
+	aead, err := newAEAD(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < aead.NonceSize() {
+		return nil, ErrIntegrity
+	}
+	data, err := aead.Open(nil, body[:aead.NonceSize()], body[aead.NonceSize():], ad)
+	if err != nil {
+		return nil, ErrIntegrity
+	}
+	return data, nil
+}
+
+// isSealed reports whether a value retrieved from the
+// store has been encrypted or signed.
+func isSealed(buf []byte) bool {
+	return len(buf) > 0 && (buf[0] == encryptedHeader || buf[0] == signedHeader)
+}
+
+// newAEAD returns AES-GCM for the key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData returns the data authenticated alongside
+// a sealed value, the header and key ID followed by the
+// length of the store key and the store key.
+func additionalData(header []byte, key string) []byte {
+	ad := make([]byte, len(header)+4+len(key))
+	n := copy(ad, header)
+	binary.BigEndian.PutUint32(ad[n:], uint32(len(key)))
+	copy(ad[n+4:], key)
+	return ad
+}
+
+// sign returns the HMAC-SHA256 of the additional data and
+// the data.
+func sign(secret, ad, data []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(ad)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
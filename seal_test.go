@@ -0,0 +1,213 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"bytes"
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+var (
+	keyV1 = bytes.Repeat([]byte{1}, 32)
+	keyV2 = bytes.Repeat([]byte{2}, 16)
+)
+
+func (t *StashTestSuite) TestNewKeyring() {
+	tt := map[string]struct {
+		primary string
+		keys    map[string][]byte
+		want    string
+	}{
+		"Valid": {
+			"v1", map[string][]byte{"v1": keyV1, "v2": keyV2}, "",
+		},
+		"Missing Primary": {
+			"v3", map[string][]byte{"v1": keyV1}, `stash: primary key "v3" not in keyring`,
+		},
+		"Invalid Size": {
+			"v1", map[string][]byte{"v1": []byte("short")}, `stash: invalid key size 5 for key "v1"`,
+		},
+		"Empty ID": {
+			"", map[string][]byte{"": keyV1}, `stash: invalid key id ""`,
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func() {
+			k, err := NewKeyring(test.primary, test.keys)
+			if test.want != "" {
+				t.EqualError(err, test.want)
+				return
+			}
+			t.NoError(err)
+			t.Equal(test.primary, k.primary)
+		})
+	}
+}
+
+func (t *StashTestSuite) TestSeal_NilKeyring() {
+	_, err := Load(NewMemory(time.Hour, time.Hour), WithEncryption(nil))
+	t.EqualError(err, "stash: nil keyring")
+	_, err = Load(NewMemory(time.Hour, time.Hour), WithIntegrity(nil))
+	t.EqualError(err, "stash: nil keyring")
+}
+
+func (t *StashTestSuite) TestSealer() {
+	k, err := NewKeyring("v1", map[string][]byte{"v1": keyV1})
+	t.NoError(err)
+	data := []byte("secret value")
+
+	for name, s := range map[string]*sealer{
+		"Encrypt":   {keyring: k, encrypt: true},
+		"Integrity": {keyring: k},
+	} {
+		t.Run(name, func() {
+			sealed, err := s.seal("key", data)
+			t.NoError(err)
+			t.True(isSealed(sealed))
+			t.Equal(s.encrypt, !bytes.Contains(sealed, data))
+
+			got, err := s.open("key", sealed)
+			t.NoError(err)
+			t.Equal(data, got)
+
+			tampered := append([]byte(nil), sealed...)
+			tampered[len(tampered)-1] ^= 0xff
+			_, err = s.open("key", tampered)
+			t.ErrorIs(err, ErrIntegrity)
+
+			_, err = s.open("key", sealed[:4])
+			t.ErrorIs(err, ErrIntegrity)
+
+			// Sealed values are bound to their key.
+			_, err = s.open("other", sealed)
+			t.ErrorIs(err, ErrIntegrity)
+
+			// The header is authenticated.
+			tampered = append([]byte(nil), sealed...)
+			tampered[0] = encryptedHeader + signedHeader - tampered[0]
+			_, err = s.open("key", tampered)
+			t.ErrorIs(err, ErrIntegrity)
+		})
+	}
+}
+
+func (t *StashTestSuite) TestWithEncryption() {
+	mr := miniredis.RunT(t.T())
+	prov := NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour)
+	ctx := context.Background()
+
+	v1, err := NewKeyring("v1", map[string][]byte{"v1": keyV1})
+	t.NoError(err)
+	c, err := Load(prov, WithEncryption(v1), WithCompression(GzipCompressor, 1))
+	t.NoError(err)
+
+	t.NoError(c.Set(ctx, "key", "personal data", Options{}))
+	raw, err := mr.Get("key")
+	t.NoError(err)
+	t.Equal(encryptedHeader, raw[0])
+	t.NotContains(raw, "personal data")
+
+	var got string
+	t.NoError(c.Get(ctx, "key", &got))
+	t.Equal("personal data", got)
+	t.NoError(c.GetMany(ctx, "key")[0].Decode(&got))
+	t.Equal("personal data", got)
+
+	// Rotating the primary key keeps existing values readable.
+	rotated, err := NewKeyring("v2", map[string][]byte{"v1": keyV1, "v2": keyV2})
+	t.NoError(err)
+	c2, err := Load(prov, WithEncryption(rotated))
+	t.NoError(err)
+	got = ""
+	t.NoError(c2.Get(ctx, "key", &got))
+	t.Equal("personal data", got)
+
+	t.NoError(c2.Set(ctx, "new", "value", Options{}))
+	raw, err = mr.Get("new")
+	t.NoError(err)
+	t.Equal("v2", raw[2:4])
+
+	// Dropping the old key makes its values unreadable.
+	v2, err := NewKeyring("v2", map[string][]byte{"v2": keyV2})
+	t.NoError(err)
+	c3, err := Load(prov, WithEncryption(v2))
+	t.NoError(err)
+	t.ErrorIs(c3.Get(ctx, "key", &got), ErrIntegrity)
+	t.NoError(c3.Get(ctx, "new", &got))
+
+	// Values that are not sealed are treated as a miss.
+	plain, err := Load(prov)
+	t.NoError(err)
+	t.NoError(plain.Set(ctx, "plain", "value", Options{}))
+	t.ErrorIs(c.Get(ctx, "plain", &got), ErrNotFound)
+	t.NoError(c.Remember(ctx, "plain", &got, Options{}, func(ctx context.Context) (interface{}, error) {
+		return "reloaded", nil
+	}))
+	t.Equal("reloaded", got)
+	t.NoError(c.Get(ctx, "plain", &got))
+
+	// A cache without a keyring cannot read sealed values.
+	t.Error(plain.Get(ctx, "key", &got))
+}
+
+func (t *StashTestSuite) TestWithIntegrity() {
+	mr := miniredis.RunT(t.T())
+	ctx := context.Background()
+
+	k, err := NewKeyring("v1", map[string][]byte{"v1": keyV1})
+	t.NoError(err)
+	c, err := Load(NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour), WithIntegrity(k))
+	t.NoError(err)
+
+	t.NoError(c.Set(ctx, "key", "value", Options{}))
+	raw, err := mr.Get("key")
+	t.NoError(err)
+	t.Equal(signedHeader, raw[0])
+	t.Contains(raw, `"value"`)
+
+	var got string
+	t.NoError(c.Get(ctx, "key", &got))
+	t.Equal("value", got)
+
+	t.NoError(mr.Set("key", raw[:len(raw)-2]+`x"`))
+	t.ErrorIs(c.Get(ctx, "key", &got), ErrIntegrity)
+
+	// Values copied from another key fail verification.
+	t.NoError(c.Set(ctx, "a", "value-of-a", Options{}))
+	raw, err = mr.Get("a")
+	t.NoError(err)
+	t.NoError(mr.Set("b", raw))
+	t.ErrorIs(c.Get(ctx, "b", &got), ErrIntegrity)
+	t.ErrorIs(c.GetMany(ctx, "b")[0].Err, ErrIntegrity)
+
+	// Unsealed tombstones and stale headers are a miss.
+	t.NoError(mr.Set("absent", string([]byte{tombstoneHeader})))
+	t.ErrorIs(c.Get(ctx, "absent", &got), ErrNotFound)
+	stale, _ := withGrace([]byte(`"value"`), Options{Expiration: time.Nanosecond, Grace: time.Hour})
+	t.NoError(mr.Set("stale", string(stale)))
+	t.ErrorIs(c.Get(ctx, "stale", &got), ErrNotFound)
+
+	// Tombstones and stale headers are sealed.
+	t.NoError(c.SetAbsent(ctx, "absent", Options{Expiration: time.Hour}))
+	raw, err = mr.Get("absent")
+	t.NoError(err)
+	t.Equal(signedHeader, raw[0])
+	t.ErrorIs(c.Get(ctx, "absent", &got), ErrAbsent)
+	t.ErrorIs(c.GetMany(ctx, "absent")[0].Err, ErrAbsent)
+
+	t.NoError(c.Set(ctx, "stale", "value", Options{Expiration: time.Nanosecond, Grace: time.Hour}))
+	raw, err = mr.Get("stale")
+	t.NoError(err)
+	t.Equal(signedHeader, raw[0])
+	time.Sleep(time.Millisecond)
+	isStale, err := c.GetWithStaleness(ctx, "stale", &got)
+	t.NoError(err)
+	t.True(isStale)
+	t.Equal("value", got)
+}
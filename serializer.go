@@ -0,0 +1,185 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Serializer defines the methods for marshalling and
+// unmarshalling values before they are sent to, and
+// after they are retrieved from the store.
+type Serializer interface {
+	// ID returns the header byte written before every
+	// value marshalled by the Serializer. It must be
+	// unique between serializers so entries written by
+	// a previous codec can be read during migration, and
+	// must not clash with the Compressor ID. IDs from 0x00
+	// to 0x1f are reserved by stash for the built-in
+	// serializers (0x01 to 0x03) and compressors (0x10 and
+	// 0x11) and the headers wrapping values (0x18 to
+	// 0x1b), custom serializers must use an ID above 0x1f.
+	// Load returns an error if the ID is reserved or
+	// clashes.
+	ID() byte
+
+	// Marshal returns the encoding of v.
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal parses the encoded data and stores the
+	// result in the value pointed to by v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+const (
+	// JSONSerializerID is the header byte for values
+	// encoded with encoding/json.
+	JSONSerializerID byte = 0x01
+	// GobSerializerID is the header byte for values
+	// encoded with encoding/gob.
+	GobSerializerID byte = 0x02
+	// MsgPackSerializerID is the header byte for values
+	// encoded with MessagePack.
+	MsgPackSerializerID byte = 0x03
+)
+
+// reservedIDMax is the last of the header bytes reserved
+// by stash, from 0x00 up to and including it. They are
+// used by the built-in serializers and compressors and
+// by the headers wrapping values: the grace period
+// (0x18), tombstones (0x19) and sealed values (0x1a and
+// 0x1b).
+const reservedIDMax byte = 0x1f
+
+var (
+	// JSONSerializer marshals values with encoding/json,
+	// it is the default Serializer used by Load.
+	JSONSerializer Serializer = jsonSerializer{}
+	// GobSerializer marshals values with encoding/gob,
+	// preserving Go types such as time zones and int64
+	// precision.
+	GobSerializer Serializer = gobSerializer{}
+	// MsgPackSerializer marshals values with MessagePack
+	// which is compact and fast for large payloads.
+	MsgPackSerializer Serializer = msgPackSerializer{}
+	// serializers are the built-in serializers keyed by
+	// their ID, used for reading entries written by a
+	// different codec.
+	serializers = map[byte]Serializer{
+		JSONSerializerID:    JSONSerializer,
+		GobSerializerID:     GobSerializer,
+		MsgPackSerializerID: MsgPackSerializer,
+	}
+)
+
+// checkIDs returns an error if the ID of a custom
+// Serializer or Compressor is reserved, or if the two
+// clash with each other.
+func checkIDs(s Serializer, c Compressor) error {
+	if s != nil && s.ID() <= reservedIDMax && serializers[s.ID()] != s {
+		return fmt.Errorf("stash: serializer ID 0x%02x is reserved, custom serializers must use an ID above 0x%02x", s.ID(), reservedIDMax)
+	}
+	if c != nil && c.ID() <= reservedIDMax && compressors[c.ID()] != c {
+		return fmt.Errorf("stash: compressor ID 0x%02x is reserved, custom compressors must use an ID above 0x%02x", c.ID(), reservedIDMax)
+	}
+	if s != nil && c != nil && s.ID() == c.ID() {
+		return fmt.Errorf("stash: serializer and compressor share the ID 0x%02x", s.ID())
+	}
+	return nil
+}
+
+// encode marshals v with the Serializer and prepends the
+// Serializer's ID.
+func encode(s Serializer, v interface{}) ([]byte, error) {
+	data, err := s.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, len(data)+1)
+	buf = append(buf, s.ID())
+	return append(buf, data...), nil
+}
+
+// decode reads the header byte of data and unmarshalls
+// the value with the matching Serializer, the current
+// Serializer is checked before the built-in ones. Data
+// without a known header was written before serializers
+// were introduced and is decoded as JSON.
+func decode(s Serializer, data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return ErrEmptyValue
+	}
+	id := data[0]
+	if s != nil && s.ID() == id {
+		return s.Unmarshal(data[1:], v)
+	}
+	if ser, ok := serializers[id]; ok {
+		return ser.Unmarshal(data[1:], v)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// jsonSerializer implements Serializer with encoding/json.
+type jsonSerializer struct{}
+
+// ID satisfies the Serializer interface.
+func (jsonSerializer) ID() byte {
+	return JSONSerializerID
+}
+
+// Marshal satisfies the Serializer interface.
+func (jsonSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal satisfies the Serializer interface.
+func (jsonSerializer) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// gobSerializer implements Serializer with encoding/gob.
+type gobSerializer struct{}
+
+// ID satisfies the Serializer interface.
+func (gobSerializer) ID() byte {
+	return GobSerializerID
+}
+
+// Marshal satisfies the Serializer interface.
+func (gobSerializer) Marshal(v interface{}) ([]byte, error) {
+	buf := bytes.Buffer{}
+	err := gob.NewEncoder(&buf).Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal satisfies the Serializer interface.
+func (gobSerializer) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// msgPackSerializer implements Serializer with MessagePack.
+type msgPackSerializer struct{}
+
+// ID satisfies the Serializer interface.
+func (msgPackSerializer) ID() byte {
+	return MsgPackSerializerID
+}
+
+// Marshal satisfies the Serializer interface.
+func (msgPackSerializer) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+// Unmarshal satisfies the Serializer interface.
+func (msgPackSerializer) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+type serializerItem struct {
+	Name    string
+	Count   int64
+	Created time.Time
+	Data    []byte
+}
+
+func (t *StashTestSuite) TestSerializer_RoundTrip() {
+	loc, err := time.LoadLocation("America/New_York")
+	t.NoError(err)
+
+	want := serializerItem{
+		Name:    "stash",
+		Count:   1<<62 + 1,
+		Created: time.Date(2020, 1, 1, 0, 0, 0, 0, loc),
+		Data:    []byte("data"),
+	}
+
+	tt := map[string]struct {
+		serializer Serializer
+		id         byte
+	}{
+		"JSON":    {JSONSerializer, JSONSerializerID},
+		"Gob":     {GobSerializer, GobSerializerID},
+		"MsgPack": {MsgPackSerializer, MsgPackSerializerID},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func() {
+			buf, err := encode(test.serializer, want)
+			t.NoError(err)
+			t.Equal(test.id, buf[0])
+
+			var got serializerItem
+			t.NoError(decode(nil, buf, &got))
+			t.Equal(want.Name, got.Name)
+			t.Equal(want.Count, got.Count)
+			t.Equal(want.Data, got.Data)
+			t.True(want.Created.Equal(got.Created))
+		})
+	}
+}
+
+func (t *StashTestSuite) TestSerializer_Gob_Location() {
+	loc, err := time.LoadLocation("America/New_York")
+	t.NoError(err)
+	want := time.Date(2020, 1, 1, 0, 0, 0, 0, loc)
+
+	buf, err := encode(GobSerializer, want)
+	t.NoError(err)
+
+	var got time.Time
+	t.NoError(decode(GobSerializer, buf, &got))
+	_, offset := got.Zone()
+	_, wantOffset := want.Zone()
+	t.Equal(wantOffset, offset)
+}
+
+func (t *StashTestSuite) TestDecode() {
+	tt := map[string]struct {
+		input []byte
+		want  interface{}
+	}{
+		"Legacy JSON": {
+			[]byte("\"stash\""),
+			"stash",
+		},
+		"Empty": {
+			nil,
+			ErrEmptyValue.Error(),
+		},
+		"Bad Data": {
+			[]byte{GobSerializerID, 0xff},
+			"unexpected EOF",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func() {
+			var got string
+			err := decode(JSONSerializer, test.input, &got)
+			if err != nil {
+				t.Contains(err.Error(), test.want)
+				return
+			}
+			t.Equal(test.want, got)
+		})
+	}
+}
+
+func (t *StashTestSuite) TestEncode_Error() {
+	_, err := encode(JSONSerializer, make(chan bool))
+	t.Error(err)
+}
+
+func (t *StashTestSuite) TestWithSerializer_Migration() {
+	p := NewMemory(time.Hour, time.Hour)
+
+	old, err := Load(p)
+	t.NoError(err)
+	t.NoError(old.Set(context.Background(), CacheKey, "stash", Options{}))
+
+	c, err := Load(p, WithSerializer(MsgPackSerializer))
+	t.NoError(err)
+	t.Equal(MsgPackSerializer, c.serializer)
+
+	var got string
+	t.NoError(c.Get(context.Background(), CacheKey, &got))
+	t.Equal("stash", got)
+
+	t.NoError(c.Set(context.Background(), CacheKey, "msgpack", Options{}))
+	t.NoError(old.Get(context.Background(), CacheKey, &got))
+	t.Equal("msgpack", got)
+}
+
+// idSerializer is a JSON Serializer with a custom ID.
+type idSerializer byte
+
+func (s idSerializer) ID() byte { return byte(s) }
+
+func (idSerializer) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (idSerializer) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+func (t *StashTestSuite) TestCheckIDs() {
+	tt := map[string]struct {
+		opts []LoadOption
+		want string
+	}{
+		"Built-in": {
+			[]LoadOption{WithSerializer(GobSerializer), WithCompression(SnappyCompressor, 0)},
+			"",
+		},
+		"Custom": {
+			[]LoadOption{WithSerializer(idSerializer(0x21)), WithCompression(errorCompressor{}, 0)},
+			"",
+		},
+		"Reserved Serializer": {
+			[]LoadOption{WithSerializer(idSerializer(signedHeader))},
+			"stash: serializer ID 0x1b is reserved, custom serializers must use an ID above 0x1f",
+		},
+		"Built-in Serializer ID": {
+			[]LoadOption{WithSerializer(idSerializer(JSONSerializerID))},
+			"stash: serializer ID 0x01 is reserved, custom serializers must use an ID above 0x1f",
+		},
+		"Reserved Compressor": {
+			[]LoadOption{WithSerializer(idSerializer(0x21)), WithCompression(idCompressor(staleHeader), 0)},
+			"stash: compressor ID 0x18 is reserved, custom compressors must use an ID above 0x1f",
+		},
+		"Clash": {
+			[]LoadOption{WithSerializer(idSerializer(0x20)), WithCompression(errorCompressor{}, 0)},
+			"stash: serializer and compressor share the ID 0x20",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func() {
+			_, err := Load(NewMemory(time.Hour, time.Hour), test.opts...)
+			if test.want == "" {
+				t.NoError(err)
+				return
+			}
+			t.EqualError(err, test.want)
+		})
+	}
+}
+
+// idCompressor is a no-op Compressor with a custom ID.
+type idCompressor byte
+
+func (c idCompressor) ID() byte { return byte(c) }
+
+func (idCompressor) Compress(data []byte) ([]byte, error) { return data, nil }
+
+func (idCompressor) Decompress(data []byte) ([]byte, error) { return data, nil }
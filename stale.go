@@ -0,0 +1,98 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+)
+
+// staleHeader prefixes values stored with a grace
+// period, it is followed by the time the value is fresh
+// until in Unix nanoseconds.
+const staleHeader byte = 0x18
+
+// staleHeaderLen is the length of the stale header and
+// the fresh until time.
+const staleHeaderLen = 9
+
+// withGrace records the time the value is fresh until and
+// extends the expiration of the options by the grace
+// period, if the options have one.
+func withGrace(value []byte, options Options) ([]byte, Options) {
+	if options.Grace <= 0 || options.Expiration <= 0 {
+		return value, options
+	}
+	buf := make([]byte, staleHeaderLen+len(value))
+	buf[0] = staleHeader
+	binary.BigEndian.PutUint64(buf[1:staleHeaderLen], uint64(time.Now().Add(options.Expiration).UnixNano()))
+	copy(buf[staleHeaderLen:], value)
+	options.Expiration += options.Grace
+	return buf, options
+}
+
+// unwrapStale removes the stale header from a value,
+// returning the value and whether it is stale. Values
+// without a header are never stale.
+func unwrapStale(buf []byte) ([]byte, bool) {
+	if len(buf) < staleHeaderLen || buf[0] != staleHeader {
+		return buf, false
+	}
+	fresh := time.Unix(0, int64(binary.BigEndian.Uint64(buf[1:staleHeaderLen])))
+	return buf[staleHeaderLen:], time.Now().After(fresh)
+}
+
+// graceTTL returns the time to live of a value stored
+// with a grace period up to its fresh until time rather
+// than the end of the grace period, or zero once it is
+// stale. The TTL of values without a header is returned
+// unchanged.
+func graceTTL(buf []byte, ttl time.Duration) time.Duration {
+	if len(buf) < staleHeaderLen || buf[0] != staleHeader {
+		return ttl
+	}
+	fresh := time.Unix(0, int64(binary.BigEndian.Uint64(buf[1:staleHeaderLen])))
+	if d := time.Until(fresh); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// GetWithStaleness retrieves a specific item from the cache
+// by key and reports whether it is stale, that is past its
+// Expiration but within its Grace period. Items stored
+// without a Grace period are never stale.
+// Returns ErrNotFound if the key does not exist.
+func (c *Cache) GetWithStaleness(ctx context.Context, key, v interface{}) (bool, error) {
+	if err := c.life.acquire(); err != nil {
+		return false, err
+	}
+	defer c.life.release()
+	k := c.key(key)
+	ctx, start := c.start(ctx, OperationGet)
+	call, stale, err := c.get(ctx, k, v)
+	c.observeLookup(ctx, start, OperationGet, k, len(call.Value), err)
+	if err != nil {
+		return false, err
+	}
+	return stale, nil
+}
+
+// refresh reloads a stale item in the background, calls
+// for the same key share a single refresh with any
+// concurrent Remember. The loader is called with the
+// cache's background context as the caller's may be
+// cancelled once the stale value is returned, it is
+// cancelled when the cache is closed.
+func (c *Cache) refresh(key interface{}, options Options, loader func(ctx context.Context) (interface{}, error)) {
+	c.group.DoChan(c.key(key), func() (interface{}, error) {
+		if err := c.life.acquire(); err != nil {
+			return nil, err
+		}
+		defer c.life.release()
+		return c.load(c.life.ctx, key, options, loader)
+	})
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func (t *StashTestSuite) TestWithGrace() {
+	value := []byte("value")
+
+	got, o := withGrace(value, Options{Expiration: time.Minute})
+	t.Equal(value, got)
+	t.Equal(time.Minute, o.Expiration)
+
+	got, o = withGrace(value, Options{Expiration: RememberForever, Grace: time.Hour})
+	t.Equal(value, got)
+	t.Equal(time.Duration(RememberForever), o.Expiration)
+
+	got, o = withGrace(value, Options{Expiration: time.Minute, Grace: time.Hour})
+	t.Equal(staleHeader, got[0])
+	t.Equal(time.Hour+time.Minute, o.Expiration)
+	buf, stale := unwrapStale(got)
+	t.Equal(value, buf)
+	t.False(stale)
+
+	got, _ = withGrace(value, Options{Expiration: time.Nanosecond, Grace: time.Hour})
+	time.Sleep(time.Millisecond)
+	buf, stale = unwrapStale(got)
+	t.Equal(value, buf)
+	t.True(stale)
+}
+
+func (t *StashTestSuite) TestGrace_Compression() {
+	c := t.LoadCache(NewMemory(time.Hour, time.Hour), WithCompression(GzipCompressor, 1))
+	ctx := context.Background()
+	o := Options{Expiration: 50 * time.Millisecond, Grace: time.Hour}
+
+	t.NoError(c.Set(ctx, "key", "value", o))
+	c.SetMany(ctx, Item{Key: "many", Value: "value", Options: o})
+
+	var got string
+	stale, err := c.GetWithStaleness(ctx, "key", &got)
+	t.NoError(err)
+	t.False(stale)
+	t.Equal("value", got)
+
+	time.Sleep(60 * time.Millisecond)
+
+	for _, key := range []string{"key", "many"} {
+		got = ""
+		stale, err = c.GetWithStaleness(ctx, key, &got)
+		t.NoError(err)
+		t.True(stale)
+		t.Equal("value", got)
+
+		got = ""
+		t.NoError(c.Get(ctx, key, &got))
+		t.Equal("value", got)
+	}
+
+	t.NoError(c.GetMany(ctx, "many")[0].Decode(&got))
+	t.Equal("value", got)
+
+	// Stale items have no time to live left.
+	ttl, err := c.TTL(ctx, "key")
+	t.NoError(err)
+	t.Equal(time.Duration(0), ttl)
+
+	_, err = c.GetWithStaleness(ctx, "missing", &got)
+	t.ErrorIs(err, ErrNotFound)
+}
+
+func (t *StashTestSuite) TestGrace_TTL() {
+	k, err := NewKeyring("v1", map[string][]byte{"v1": keyV1})
+	t.NoError(err)
+
+	tt := map[string][]LoadOption{
+		"Plain":     nil,
+		"Encrypted": {WithEncryption(k)},
+	}
+
+	for name, opts := range tt {
+		t.Run(name, func() {
+			c, err := Load(NewMemory(time.Hour, time.Hour), opts...)
+			t.NoError(err)
+			ctx := context.Background()
+
+			// The TTL runs to the end of the Expiration
+			// rather than the Grace period.
+			t.NoError(c.Set(ctx, "fresh", "value", Options{Expiration: time.Minute, Grace: time.Hour}))
+			ttl, err := c.TTL(ctx, "fresh")
+			t.NoError(err)
+			t.InDelta(time.Minute, ttl, float64(time.Second))
+			var got string
+			ttl, err = c.GetWithTTL(ctx, "fresh", &got)
+			t.NoError(err)
+			t.InDelta(time.Minute, ttl, float64(time.Second))
+			t.Equal("value", got)
+
+			// Stale items report zero.
+			t.NoError(c.Set(ctx, "stale", "value", Options{Expiration: time.Millisecond, Grace: time.Hour}))
+			time.Sleep(5 * time.Millisecond)
+			ttl, err = c.TTL(ctx, "stale")
+			t.NoError(err)
+			t.Equal(time.Duration(0), ttl)
+			ttl, err = c.GetWithTTL(ctx, "stale", &got)
+			t.NoError(err)
+			t.Equal(time.Duration(0), ttl)
+			t.Equal("value", got)
+		})
+	}
+}
+
+func (t *StashTestSuite) TestRemember_Stale() {
+	c, err := Load(NewMemory(time.Hour, time.Hour))
+	t.NoError(err)
+	ctx := context.Background()
+	o := Options{Expiration: 50 * time.Millisecond, Grace: time.Hour}
+
+	t.NoError(c.Set(ctx, "key", "stale", o))
+	time.Sleep(60 * time.Millisecond)
+
+	var calls int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "fresh", nil
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var got string
+			t.NoError(c.Remember(ctx, "key", &got, o, loader))
+			t.Equal("stale", got)
+		}()
+	}
+	wg.Wait()
+	close(release)
+
+	t.Eventually(func() bool {
+		var got string
+		stale, err := c.GetWithStaleness(ctx, "key", &got)
+		return err == nil && !stale && got == "fresh"
+	}, time.Second, time.Millisecond)
+	t.Equal(int32(1), atomic.LoadInt32(&calls))
+}
+
+func (t *StashTestSuite) TestTypedCache_GetWithStaleness() {
+	c, err := Load(NewMemory(time.Hour, time.Hour))
+	t.NoError(err)
+	ctx := context.Background()
+	tc := NewTypedCache[string, int](c)
+
+	_, _, err = tc.GetWithStaleness(ctx, "key")
+	t.ErrorIs(err, ErrNotFound)
+
+	t.NoError(tc.Set(ctx, "key", 1, Options{Expiration: time.Nanosecond, Grace: time.Hour}))
+	time.Sleep(time.Millisecond)
+	got, stale, err := tc.GetWithStaleness(ctx, "key")
+	t.NoError(err)
+	t.True(stale)
+	t.Equal(1, got)
+}
@@ -6,11 +6,10 @@ package stash
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"github.com/eko/gocache/v2/store"
-	"github.com/spf13/cast"
-	"sync"
+	"golang.org/x/sync/singleflight"
+	"time"
 )
 
 // Store defines methods for interacting with the
@@ -18,33 +17,134 @@ import (
 type Store interface {
 	// Get retrieves a specific item from the cache by key. Values are
 	// automatically marshalled for use with Redis & Memcache.
+	// Returns ErrNotFound if the key does not exist.
 	Get(ctx context.Context, key, v interface{}) error
 
+	// GetWithTTL retrieves a specific item from the cache by key
+	// and returns its remaining time to live. NoExpiration is
+	// returned if the item does not expire.
+	// Returns ErrNotFound if the key does not exist.
+	GetWithTTL(ctx context.Context, key, v interface{}) (time.Duration, error)
+
+	// TTL returns the remaining time to live of an item
+	// without unmarshalling it. NoExpiration is returned if
+	// the item does not expire.
+	// Returns ErrNotFound if the key does not exist.
+	TTL(ctx context.Context, key interface{}) (time.Duration, error)
+
+	// GetWithStaleness retrieves a specific item from the cache
+	// by key and reports whether it is past its Expiration but
+	// within its Grace period.
+	// Returns ErrNotFound if the key does not exist.
+	GetWithStaleness(ctx context.Context, key, v interface{}) (bool, error)
+
 	// Set stores a singular item in memory by key, value
 	// and options (tags and expiration time). Values are automatically
 	// marshalled for use with Redis & Memcache.
 	Set(ctx context.Context, key interface{}, value interface{}, options Options) error
 
+	// Add stores the item only if the key does not exist,
+	// returning ErrKeyExists if it does.
+	Add(ctx context.Context, key interface{}, value interface{}, options Options) error
+
+	// Replace stores the item only if the key exists,
+	// returning ErrNotFound if it does not.
+	Replace(ctx context.Context, key interface{}, value interface{}, options Options) error
+
+	// SetAbsent stores a tombstone for the key, Get returns
+	// ErrAbsent for the key until the tombstone expires
+	// after the options' AbsentExpiration.
+	SetAbsent(ctx context.Context, key interface{}, options Options) error
+
 	// Delete removes a singular item from the cache by
 	// a specific key.
 	Delete(ctx context.Context, key interface{}) error
 
+	// Exists reports whether each key is stored, in the
+	// same order as the keys passed, without unmarshalling
+	// the values.
+	Exists(ctx context.Context, keys ...interface{}) ([]bool, error)
+
+	// GetMany retrieves multiple items from the cache by key.
+	// Use Result.Decode to unmarshal each value, keys that do
+	// not exist have an Err of ErrNotFound.
+	GetMany(ctx context.Context, keys ...interface{}) Results
+
+	// SetMany stores multiple items in the cache. Values are
+	// automatically marshalled.
+	SetMany(ctx context.Context, items ...Item) Results
+
+	// DeleteMany removes multiple items from the cache by
+	// key.
+	DeleteMany(ctx context.Context, keys ...interface{}) Results
+
 	// Invalidate removes items from the cache via the
 	// InvalidateOptions passed.
 	Invalidate(ctx context.Context, options InvalidateOptions) error
 
 	// Clear removes all items from the cache.
 	Clear(ctx context.Context) error
+
+	// Remember retrieves an item from the cache by key, if the
+	// item does not exist the loader is called and the result
+	// is stored with the options passed. Concurrent calls for
+	// the same key share a single call to the loader.
+	Remember(ctx context.Context, key, v interface{}, options Options, loader func(ctx context.Context) (interface{}, error)) error
+
+	// Close waits for operations in flight to finish and
+	// releases the resources owned by the cache, subsequent
+	// calls return ErrClosed.
+	Close(ctx context.Context) error
 }
 
 // Cache defines the methods for interacting with the
 // cache layer.
 type Cache struct {
+	// provider is the Provider the cache was loaded with,
+	// it is closed by Close.
+	provider Provider
+	// life tracks the operations in flight so they can be
+	// drained by Close.
+	life *lifecycle
 	// store is the package store interface used for interacting
-	// with the cache store.
+	// with the cache store. Keys are converted to strings by
+	// the cache before being passed to the store.
 	store store.StoreInterface
+	// locks is the sharded mutex owned by the cache, it
+	// guards read-modify-write operations such as tag
+	// updates without blocking other caches. Caches
+	// derived with WithNamespace share their parent's.
+	locks *keyLock
+	// group deduplicates concurrent loads for the same key
+	// when calling Remember.
+	group singleflight.Group
+	// serializer is used to marshal and unmarshal values,
+	// JSONSerializer is used when nil.
+	serializer Serializer
+	// compression compresses serialized values when set
+	// via WithCompression.
+	compression *compression
+	// sealer encrypts or signs serialized values, set via
+	// WithEncryption or WithIntegrity.
+	sealer *sealer
+	// namespace is the prefix applied to every key and
+	// tag, set via WithNamespace.
+	namespace string
+	// namespaces is the prefix of each level of a nested
+	// namespace, the last being the namespace itself.
+	namespaces []string
+	// bus broadcasts invalidations to other instances,
+	// set via WithInvalidationBus.
+	bus *busConfig
+	// instrumentation is notified of every operation,
+	// set via WithInstrumentation.
+	instrumentation []Instrumentation
+	// middleware wraps every store operation, set via
+	// WithMiddleware.
+	middleware []Middleware
 	// Driver is the current store being used, it can be
-	// MemoryDriver, RedisDriver or MemcachedDriver.
+	// MemoryDriver, RedisDriver, MemcachedDriver or
+	// ChainDriver.
 	Driver string
 }
 
@@ -58,15 +158,15 @@ const (
 	// MemcacheDriver is the Memcached Driver, depicted
 	// in the environment.
 	MemcacheDriver = "memcache"
+	// ChainDriver is the multi tier Driver created
+	// by NewChain.
+	ChainDriver = "chain"
 	// RememberForever is an alias for setting the
 	// cache item to never be removed.
 	RememberForever = -1
-)
-
-var (
-	// Prevents data races when setting & getting cache
-	// items.
-	mtx = sync.Mutex{}
+	// NoExpiration is the TTL returned by GetWithTTL
+	// and TTL when the cache item does not expire.
+	NoExpiration time.Duration = -1
 )
 
 // Load initialises the cache store by the environment.
@@ -74,11 +174,24 @@ var (
 // getting setting and deleting. Drivers supported are Memory
 // Redis and MemCached.
 // Returns ErrInvalidDriver if the Driver passed does not exist.
-func Load(prov Provider) (*Cache, error) {
+// LoadOption's can be passed to configure the Cache.
+// The provider is closed if the Cache cannot be loaded.
+func Load(prov Provider, opts ...LoadOption) (*Cache, error) {
 	if prov == nil {
 		return nil, errors.New("provider cannot be nil")
 	}
 
+	c, err := load(prov, opts...)
+	if err != nil {
+		_ = prov.Close(context.Background())
+		return nil, err
+	}
+	return c, nil
+}
+
+// load validates the provider and creates the Cache with
+// the options applied.
+func load(prov Provider, opts ...LoadOption) (*Cache, error) {
 	err := prov.Validate()
 	if err != nil {
 		return nil, err
@@ -89,65 +202,368 @@ func Load(prov Provider) (*Cache, error) {
 		return nil, err
 	}
 
-	return &Cache{
-		store:  prov.Store(),
-		Driver: prov.Driver(),
-	}, nil
+	c := &Cache{
+		provider:   prov,
+		life:       newLifecycle(),
+		store:      prov.Store(),
+		locks:      &keyLock{},
+		Driver:     prov.Driver(),
+		serializer: JSONSerializer,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	var comp Compressor
+	if c.compression != nil {
+		if c.compression.compressor == nil {
+			return nil, errors.New("stash: nil compressor")
+		}
+		comp = c.compression.compressor
+	}
+	err = checkIDs(c.serializer, comp)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.sealer != nil && c.sealer.keyring == nil {
+		return nil, errors.New("stash: nil keyring")
+	}
+
+	if c.bus != nil {
+		err = c.subscribe(context.Background())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
 }
 
 // Get retrieves a specific item from the cache by key. Values are
 // automatically marshalled for use with Redis & Memcache.
+// Returns ErrNotFound if the key does not exist, or ErrAbsent
+// if the key has been marked as absent with SetAbsent.
 func (c *Cache) Get(ctx context.Context, key, v interface{}) error {
-	mtx.Lock()
-	defer mtx.Unlock()
+	if err := c.life.acquire(); err != nil {
+		return err
+	}
+	defer c.life.release()
+	k := c.key(key)
+	ctx, start := c.start(ctx, OperationGet)
+	call, _, err := c.get(ctx, k, v)
+	c.observeLookup(ctx, start, OperationGet, k, len(call.Value), err)
+	return err
+}
 
-	result, err := c.store.Get(ctx, key)
-	switch r := result.(type) {
-	case []byte:
-		err = json.Unmarshal(r, v)
-	case string:
-		err = json.Unmarshal([]byte(r), v)
+// GetWithTTL retrieves a specific item from the cache by key
+// and returns its remaining time to live. NoExpiration is
+// returned if the item does not expire. For items with a
+// Grace period the TTL runs to the end of the Expiration,
+// it is zero once the item is stale. Memcached cannot
+// report TTLs, so the expiry time is stored alongside items
+// set through stash with the Memcache Driver.
+// Returns ErrNotFound if the key does not exist.
+func (c *Cache) GetWithTTL(ctx context.Context, key, v interface{}) (time.Duration, error) {
+	if err := c.life.acquire(); err != nil {
+		return 0, err
+	}
+	defer c.life.release()
+	k := c.key(key)
+	ctx, start := c.start(ctx, OperationGetWithTTL)
+	call := &Call{Operation: OperationGetWithTTL, Key: k}
+	err := c.handle(ctx, call)
+	if err == nil {
+		err = c.decode(k, call.Value, v)
 	}
+	c.observeLookup(ctx, start, OperationGetWithTTL, k, len(call.Value), err)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.ttl(k, call), nil
+}
 
+// TTL returns the remaining time to live of an item
+// without unmarshalling it. NoExpiration is returned if
+// the item does not expire. For items with a Grace period
+// the TTL runs to the end of the Expiration, it is zero
+// once the item is stale.
+// Returns ErrNotFound if the key does not exist.
+func (c *Cache) TTL(ctx context.Context, key interface{}) (time.Duration, error) {
+	if err := c.life.acquire(); err != nil {
+		return 0, err
+	}
+	defer c.life.release()
+	k := c.key(key)
+	ctx, start := c.start(ctx, OperationTTL)
+	call := &Call{Operation: OperationTTL, Key: k}
+	err := c.handle(ctx, call)
+	c.observeLookup(ctx, start, OperationTTL, k, 0, err)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	return c.ttl(k, call), nil
+}
 
-	return nil
+// ttl returns the remaining time to live of the item
+// retrieved by the call, excluding its Grace period.
+func (c *Cache) ttl(key string, call *Call) time.Duration {
+	buf, err := c.open(key, call.Value)
+	if err != nil {
+		return call.TTL
+	}
+	return graceTTL(buf, call.TTL)
 }
 
 // Set stores a singular item in memory by key, value
 // and options (tags and expiration time). Values are automatically
-// marshalled for use with Redis & Memcache.
+// marshalled with the cache's Serializer for use with Redis & Memcache.
 func (c *Cache) Set(ctx context.Context, key interface{}, value interface{}, options Options) error {
-	mtx.Lock()
-	defer mtx.Unlock()
-	marshal, err := json.Marshal(value)
-	if err != nil {
+	if err := c.life.acquire(); err != nil {
 		return err
 	}
-	return c.store.Set(ctx, key, marshal, options.toStore())
+	defer c.life.release()
+	ctx, start := c.start(ctx, OperationSet)
+	marshal, err := c.marshal(value)
+	if err == nil {
+		err = c.set(ctx, key, marshal, options)
+	}
+	c.observe(ctx, start, Event{Operation: OperationSet, Keys: []string{c.key(key)}, Size: len(marshal), Err: err})
+	return err
 }
 
 // Delete removes a singular item from the cache by
 // a specific key.
 func (c *Cache) Delete(ctx context.Context, key interface{}) error {
-	mtx.Lock()
-	defer mtx.Unlock()
-	return c.store.Delete(ctx, cast.ToString(key))
+	if err := c.life.acquire(); err != nil {
+		return err
+	}
+	defer c.life.release()
+	ctx, start := c.start(ctx, OperationDelete)
+	err := c.delete(ctx, key)
+	c.observe(ctx, start, Event{Operation: OperationDelete, Keys: []string{c.key(key)}, Err: err})
+	return err
+}
+
+// delete removes an item from the store and broadcasts
+// its key.
+func (c *Cache) delete(ctx context.Context, key interface{}) error {
+	k := c.key(key)
+	defer c.locks.lock(k)()
+	call := &Call{Operation: OperationDelete, Key: k}
+	err := c.handle(ctx, call)
+	if err != nil {
+		return err
+	}
+	return c.publish(ctx, Invalidation{Keys: []string{call.Key}})
 }
 
 // Invalidate removes items from the cache via the
 // InvalidateOptions passed.
 func (c *Cache) Invalidate(ctx context.Context, options InvalidateOptions) error {
-	mtx.Lock()
-	defer mtx.Unlock()
-	return c.store.Invalidate(ctx, options.toStore())
+	if err := c.life.acquire(); err != nil {
+		return err
+	}
+	defer c.life.release()
+	ctx, start := c.start(ctx, OperationInvalidate)
+	err := c.invalidate(ctx, options)
+	c.observe(ctx, start, Event{Operation: OperationInvalidate, Err: err})
+	return err
+}
+
+// invalidate removes the tagged items from the store and
+// broadcasts their keys and tags.
+func (c *Cache) invalidate(ctx context.Context, options InvalidateOptions) error {
+	options = c.invalidateOptions(options)
+	defer c.locks.lock(tagKeys(options.Tags)...)()
+	keys, err := c.tagKeys(ctx, options.Tags)
+	if err != nil {
+		return err
+	}
+	err = c.handle(ctx, &Call{Operation: OperationInvalidate, InvalidateOptions: options})
+	if err != nil {
+		return err
+	}
+	return c.publish(ctx, Invalidation{Keys: keys, Tags: options.Tags})
 }
 
-// Clear removes all items from the cache.
+// Clear removes all items from the cache. If the cache
+// has a namespace only the items within the namespace
+// are removed.
 func (c *Cache) Clear(ctx context.Context) error {
-	mtx.Lock()
-	defer mtx.Unlock()
-	return c.store.Clear(ctx)
+	if err := c.life.acquire(); err != nil {
+		return err
+	}
+	defer c.life.release()
+	ctx, start := c.start(ctx, OperationClear)
+	err := c.clear(ctx)
+	c.observe(ctx, start, Event{Operation: OperationClear, Err: err})
+	return err
+}
+
+// clear removes the items within the cache's namespace
+// and broadcasts the clear.
+func (c *Cache) clear(ctx context.Context) error {
+	defer c.locks.lockAll()()
+	err := c.handle(ctx, &Call{Operation: OperationClear})
+	if err != nil {
+		return err
+	}
+	return c.publish(ctx, Invalidation{Clear: true, Namespace: c.namespace})
+}
+
+// get retrieves an item from the store by its store key
+// and unmarshalls it into v, returning the call made to
+// the store and whether the item is stale.
+func (c *Cache) get(ctx context.Context, key string, v interface{}) (*Call, bool, error) {
+	call := &Call{Operation: OperationGet, Key: key}
+	err := c.handle(ctx, call)
+	if err != nil {
+		return call, false, err
+	}
+	buf, stale, err := c.unwrap(key, call.Value)
+	if err != nil {
+		return call, false, err
+	}
+	return call, stale, c.unmarshal(buf, v)
+}
+
+// set stores an already marshalled value in the store,
+// locking the key and any tags associated with it.
+func (c *Cache) set(ctx context.Context, key interface{}, value []byte, options Options) error {
+	return c.write(ctx, OperationSet, key, value, options)
+}
+
+// write performs a store operation that writes an already
+// marshalled value (OperationSet, OperationAdd or
+// OperationReplace), locking the key and any tags
+// associated with it.
+func (c *Cache) write(ctx context.Context, op string, key interface{}, value []byte, options Options) error {
+	k := c.key(key)
+	value, options = withGrace(value, options)
+	value, err := c.seal(k, value)
+	if err != nil {
+		return err
+	}
+	defer c.locks.lock(c.lockKeys(key, options.Tags)...)()
+	call := &Call{Operation: op, Key: k, Value: value, Options: c.storeOptions(options)}
+	err = c.handle(ctx, call)
+	if err != nil {
+		return err
+	}
+	return c.publish(ctx, Invalidation{Keys: []string{call.Key}})
+}
+
+// marshal encodes a value with the cache's Serializer and
+// compresses it if compression is enabled.
+func (c *Cache) marshal(value interface{}) ([]byte, error) {
+	buf, err := encode(c.codec(), value)
+	if err != nil {
+		return nil, err
+	}
+	if c.compression != nil {
+		buf, err = c.compression.compress(buf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// seal encrypts or signs a value to be stored under the
+// store key if encryption or integrity is enabled. It is
+// applied last, so stale headers and tombstones are sealed
+// along with the value.
+func (c *Cache) seal(key string, buf []byte) ([]byte, error) {
+	if c.sealer == nil {
+		return buf, nil
+	}
+	return c.sealer.seal(key, buf)
+}
+
+// unwrap opens a result obtained from the store under the
+// store key and removes its stale header, returning the
+// marshalled value and whether it is stale. ErrAbsent is
+// returned for tombstones.
+func (c *Cache) unwrap(key string, result interface{}) ([]byte, bool, error) {
+	buf, err := c.open(key, toBytes(result))
+	if err != nil {
+		return nil, false, err
+	}
+	buf, stale := unwrapStale(buf)
+	if isTombstone(buf) {
+		return nil, false, ErrAbsent
+	}
+	return buf, stale, nil
+}
+
+// decode unwraps a result obtained from the store under
+// the store key and unmarshalls it into v.
+func (c *Cache) decode(key string, result, v interface{}) error {
+	buf, _, err := c.unwrap(key, result)
+	if err != nil {
+		return err
+	}
+	return c.unmarshal(buf, v)
+}
+
+// unmarshal decompresses and unmarshalls a marshalled
+// value into v.
+func (c *Cache) unmarshal(buf []byte, v interface{}) error {
+	var comp Compressor
+	if c.compression != nil {
+		comp = c.compression.compressor
+	}
+	buf, err := decompress(comp, buf)
+	if err != nil {
+		return err
+	}
+	return decode(c.codec(), buf, v)
+}
+
+// open decrypts or verifies a value stored under the key
+// if the cache seals values. Values that are not sealed
+// are treated as a miss so they are reloaded from the
+// source.
+func (c *Cache) open(key string, buf []byte) ([]byte, error) {
+	if c.sealer == nil {
+		if isSealed(buf) {
+			return nil, errors.New("stash: value is sealed but the cache has no keyring")
+		}
+		return buf, nil
+	}
+	if !isSealed(buf) {
+		return nil, ErrNotFound
+	}
+	return c.sealer.open(key, buf)
+}
+
+// CompressionStats returns the statistics for values
+// compressed by the cache. The zero value is returned
+// if compression is not enabled.
+func (c *Cache) CompressionStats() CompressionStats {
+	if c.compression == nil {
+		return CompressionStats{}
+	}
+	return c.compression.stats()
+}
+
+// codec returns the Serializer used by the cache.
+func (c *Cache) codec() Serializer {
+	if c.serializer == nil {
+		return JSONSerializer
+	}
+	return c.serializer
+}
+
+// normaliseTTL converts the TTL's returned by the stores
+// for items that do not expire (go-cache returns a negative
+// duration since the zero time, Redis returns -1) to
+// NoExpiration.
+func normaliseTTL(ttl time.Duration) time.Duration {
+	if ttl < 0 {
+		return NoExpiration
+	}
+	return ttl
 }
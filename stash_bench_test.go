@@ -0,0 +1,93 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// benchCaches returns n independent memory caches.
+func benchCaches(b *testing.B, n int) []*Cache {
+	b.Helper()
+	caches := make([]*Cache, n)
+	for i := range caches {
+		c, err := Load(NewMemory(time.Hour, time.Hour))
+		if err != nil {
+			b.Fatal(err)
+		}
+		caches[i] = c
+	}
+	return caches
+}
+
+func BenchmarkCache_Get(b *testing.B) {
+	for _, n := range []int{1, 4, 16} {
+		b.Run(strconv.Itoa(n)+"-caches", func(b *testing.B) {
+			caches := benchCaches(b, n)
+			ctx := context.Background()
+			for _, c := range caches {
+				if err := c.Set(ctx, CacheKey, "stash", Options{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var (
+					i   int
+					tmp string
+				)
+				for pb.Next() {
+					_ = caches[i%n].Get(ctx, CacheKey, &tmp)
+					i++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkCache_Set(b *testing.B) {
+	for _, n := range []int{1, 4, 16} {
+		b.Run(strconv.Itoa(n)+"-caches", func(b *testing.B) {
+			caches := benchCaches(b, n)
+			ctx := context.Background()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					_ = caches[i%n].Set(ctx, strconv.Itoa(i%1024), "stash", Options{})
+					i++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkCache_GetSet(b *testing.B) {
+	for _, n := range []int{1, 4, 16} {
+		b.Run(strconv.Itoa(n)+"-caches", func(b *testing.B) {
+			caches := benchCaches(b, n)
+			ctx := context.Background()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var (
+					i   int
+					tmp string
+				)
+				for pb.Next() {
+					c, key := caches[i%n], strconv.Itoa(i%1024)
+					if i%4 == 0 {
+						_ = c.Set(ctx, key, "stash", Options{Tags: []string{"bench"}})
+					} else {
+						_ = c.Get(ctx, key, &tmp)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
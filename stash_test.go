@@ -8,10 +8,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/lacuna-seo/stash/internal/memcachetest"
 	"github.com/lacuna-seo/stash/mocks"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 	"testing"
+	"time"
 )
 
 const (
@@ -37,9 +42,47 @@ func (t *StashTestSuite) Setup(mf func(m *mocks.StoreInterface)) *Cache {
 	}
 	return &Cache{
 		store: m,
+		locks: &keyLock{},
+		life:  newLifecycle(),
 	}
 }
 
+// Providers returns a Provider for every Driver and a
+// Chain, backed by in-process servers. The providers are
+// closed once the test finishes.
+func (t *StashTestSuite) Providers() map[string]Provider {
+	tt := t.T()
+	mr := miniredis.RunT(tt)
+	srv, err := memcachetest.New()
+	t.Require().NoError(err)
+
+	providers := map[string]Provider{
+		"Memory":   NewMemory(time.Hour, time.Hour),
+		"Redis":    NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour),
+		"Memcache": NewMemcache([]string{srv.Addr()}, time.Hour),
+		"Chain":    NewChain(time.Minute, NewMemory(time.Hour, time.Hour), NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour)),
+	}
+	tt.Cleanup(func() {
+		for _, p := range providers {
+			assert.NoError(tt, p.Close(context.Background()))
+		}
+		assert.NoError(tt, srv.Close())
+	})
+	return providers
+}
+
+// LoadCache loads a Cache with the provider and options
+// passed, closing it once the test finishes.
+func (t *StashTestSuite) LoadCache(p Provider, opts ...LoadOption) *Cache {
+	tt := t.T()
+	c, err := Load(p, opts...)
+	t.Require().NoError(err)
+	tt.Cleanup(func() {
+		assert.NoError(tt, c.Close(context.Background()))
+	})
+	return c
+}
+
 func (t *StashTestSuite) TestLoad() {
 	tt := map[string]struct {
 		mock func(m *mocks.Provider)
@@ -57,6 +100,7 @@ func (t *StashTestSuite) TestLoad() {
 		"Validate Error": {
 			func(m *mocks.Provider) {
 				m.On("Validate").Return(errors.New("validate error"))
+				m.On("Close", mock.Anything).Return(nil)
 			},
 			"validate error",
 		},
@@ -65,6 +109,7 @@ func (t *StashTestSuite) TestLoad() {
 				m.On("Validate").Return(nil)
 				m.On("Ping").Return(errors.New("ping error"))
 				m.On("Driver").Return(MemoryDriver)
+				m.On("Close", mock.Anything).Return(nil)
 			},
 			"ping error",
 		},
@@ -79,6 +124,7 @@ func (t *StashTestSuite) TestLoad() {
 			c, err := Load(m)
 			if err != nil {
 				t.Contains(err.Error(), test.want)
+				m.AssertCalled(t.T(), "Close", mock.Anything)
 				return
 			}
 			if c == nil {
@@ -137,6 +183,19 @@ func (t *StashTestSuite) TestStash_Get() {
 			},
 			"get error",
 		},
+		"Not Found": {
+			func(m *mocks.StoreInterface) {
+				m.On("Get", mock.Anything, mock.Anything).
+					Return(nil, redis.Nil)
+			},
+			func(c *Cache) (interface{}, error) {
+				var tmp string
+				err := c.Get(context.Background(), "key", &tmp)
+				t.ErrorIs(err, ErrNotFound)
+				return tmp, err
+			},
+			ErrNotFound.Error(),
+		},
 		"Byte Slice": {
 			func(m *mocks.StoreInterface) {
 				m.On("Get", mock.Anything, mock.Anything).
@@ -307,3 +366,100 @@ func (t *StashTestSuite) TestStash_Clear() {
 		})
 	}
 }
+
+func (t *StashTestSuite) TestStash_GetWithTTL() {
+	tt := map[string]struct {
+		mock func(m *mocks.StoreInterface)
+		want interface{}
+		ttl  time.Duration
+	}{
+		"Success": {
+			func(m *mocks.StoreInterface) {
+				m.On("GetWithTTL", mock.Anything, mock.Anything).
+					Return("\"item\"", time.Minute, nil)
+			},
+			"item",
+			time.Minute,
+		},
+		"No Expiration": {
+			func(m *mocks.StoreInterface) {
+				m.On("GetWithTTL", mock.Anything, mock.Anything).
+					Return("\"item\"", time.Duration(-1), nil)
+			},
+			"item",
+			NoExpiration,
+		},
+		"Not Found": {
+			func(m *mocks.StoreInterface) {
+				m.On("GetWithTTL", mock.Anything, mock.Anything).
+					Return(nil, time.Duration(0), redis.Nil)
+			},
+			ErrNotFound.Error(),
+			0,
+		},
+		"Decode Error": {
+			func(m *mocks.StoreInterface) {
+				m.On("GetWithTTL", mock.Anything, mock.Anything).
+					Return("1", time.Minute, nil)
+			},
+			"cannot unmarshal",
+			0,
+		},
+		"Empty Value": {
+			func(m *mocks.StoreInterface) {
+				m.On("GetWithTTL", mock.Anything, mock.Anything).
+					Return(nil, time.Minute, nil)
+			},
+			ErrEmptyValue.Error(),
+			0,
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func() {
+			c := t.Setup(test.mock)
+			var got string
+			ttl, err := c.GetWithTTL(context.Background(), "key", &got)
+			t.Equal(test.ttl, ttl)
+			if err != nil {
+				t.Contains(err.Error(), test.want)
+				return
+			}
+			t.Equal(test.want, got)
+		})
+	}
+}
+
+func (t *StashTestSuite) TestStash_TTL() {
+	tt := map[string]struct {
+		mock func(m *mocks.StoreInterface)
+		want interface{}
+	}{
+		"Success": {
+			func(m *mocks.StoreInterface) {
+				m.On("GetWithTTL", mock.Anything, mock.Anything).
+					Return("\"item\"", time.Minute, nil)
+			},
+			time.Minute,
+		},
+		"Error": {
+			func(m *mocks.StoreInterface) {
+				m.On("GetWithTTL", mock.Anything, mock.Anything).
+					Return(nil, time.Duration(0), fmt.Errorf("ttl error"))
+			},
+			"ttl error",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func() {
+			c := t.Setup(test.mock)
+			got, err := c.TTL(context.Background(), "key")
+			if err != nil {
+				t.Contains(err.Error(), test.want)
+				return
+			}
+			t.Equal(test.want, got)
+		})
+	}
+}
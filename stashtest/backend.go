@@ -0,0 +1,219 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stashtest
+
+import (
+	"context"
+	"fmt"
+	"github.com/eko/gocache/v2/store"
+	"github.com/lacuna-seo/stash"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backendType is the store type returned by the
+// backend's GetType, and the Driver of the Cache within
+// a Store.
+const backendType = "stashtest"
+
+// backend defines an in-memory store.StoreInterface that
+// expires items using a Clock, it is the store used by
+// the Cache within a Store.
+type backend struct {
+	mtx   sync.Mutex
+	clock *Clock
+	items map[string]entry
+	tags  map[string]map[string]struct{}
+}
+
+// entry defines a single item within the backend.
+type entry struct {
+	value  interface{}
+	expiry time.Time
+}
+
+// newBackend creates an empty backend using the clock.
+func newBackend(clock *Clock) *backend {
+	return &backend{
+		clock: clock,
+		items: make(map[string]entry),
+		tags:  make(map[string]map[string]struct{}),
+	}
+}
+
+// Get satisfies the store.StoreInterface by returning the
+// value of an unexpired item.
+func (b *backend) Get(ctx context.Context, key interface{}) (interface{}, error) {
+	value, _, err := b.GetWithTTL(ctx, key)
+	return value, err
+}
+
+// GetWithTTL satisfies the store.StoreInterface by
+// returning the value of an unexpired item and its
+// remaining time to live, or -1 if it does not expire.
+func (b *backend) GetWithTTL(_ context.Context, key interface{}) (interface{}, time.Duration, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	e, ok := b.lookup(fmt.Sprint(key))
+	if !ok {
+		return nil, 0, stash.ErrNotFound
+	}
+	if e.expiry.IsZero() {
+		return e.value, -1, nil
+	}
+	return e.value, e.expiry.Sub(b.clock.Now()), nil
+}
+
+// Set satisfies the store.StoreInterface by storing the
+// value, items with an expiration of zero or less never
+// expire.
+func (b *backend) Set(_ context.Context, key interface{}, value interface{}, options *store.Options) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	k := fmt.Sprint(key)
+	e := entry{value: value}
+	if options != nil && options.Expiration > 0 {
+		e.expiry = b.clock.Now().Add(options.Expiration)
+	}
+	b.items[k] = e
+	if options != nil {
+		for _, tag := range options.Tags {
+			if b.tags[tag] == nil {
+				b.tags[tag] = make(map[string]struct{})
+			}
+			b.tags[tag][k] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// Delete satisfies the store.StoreInterface by removing
+// the item.
+func (b *backend) Delete(_ context.Context, key interface{}) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	delete(b.items, fmt.Sprint(key))
+	return nil
+}
+
+// Invalidate satisfies the store.StoreInterface by
+// removing every item associated with the tags.
+func (b *backend) Invalidate(_ context.Context, options store.InvalidateOptions) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for _, tag := range options.Tags {
+		for key := range b.tags[tag] {
+			delete(b.items, key)
+		}
+		delete(b.tags, tag)
+	}
+	return nil
+}
+
+// Clear satisfies the store.StoreInterface by removing
+// every item.
+func (b *backend) Clear(_ context.Context) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.items = make(map[string]entry)
+	b.tags = make(map[string]map[string]struct{})
+	return nil
+}
+
+// GetType satisfies the store.StoreInterface by returning
+// the backend type.
+func (b *backend) GetType() string {
+	return backendType
+}
+
+// ClearPrefix satisfies the stash.PrefixClearer interface
+// by removing every key that begins with the prefix.
+func (b *backend) ClearPrefix(_ context.Context, prefix string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for key := range b.items {
+		if strings.HasPrefix(key, prefix) {
+			delete(b.items, key)
+		}
+	}
+	return nil
+}
+
+// Exists satisfies the stash.ExistenceChecker interface
+// by looking up each unexpired key.
+func (b *backend) Exists(_ context.Context, keys []string) ([]bool, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		_, found[i] = b.lookup(key)
+	}
+	return found, nil
+}
+
+// TagKeys satisfies the stash.TagResolver interface by
+// listing the unexpired keys associated with the tags.
+func (b *backend) TagKeys(_ context.Context, tags []string) ([]string, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	var keys []string
+	for _, tag := range tags {
+		for key := range b.tags[tag] {
+			if _, ok := b.lookup(key); ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// lookup returns an unexpired item, expired items are
+// removed. The mutex must be held.
+func (b *backend) lookup(key string) (entry, bool) {
+	e, ok := b.items[key]
+	if !ok {
+		return entry{}, false
+	}
+	if !e.expiry.IsZero() && !b.clock.Now().Before(e.expiry) {
+		delete(b.items, key)
+		return entry{}, false
+	}
+	return e, true
+}
+
+// backendProvider defines the stash.Provider used to load
+// the Cache within a Store.
+type backendProvider struct {
+	backend *backend
+}
+
+// Ping satisfies the stash.Provider interface.
+func (p *backendProvider) Ping() error {
+	return nil
+}
+
+// Validate satisfies the stash.Provider interface.
+func (p *backendProvider) Validate() error {
+	return nil
+}
+
+// Driver satisfies the stash.Provider interface by
+// returning the backend type.
+func (p *backendProvider) Driver() string {
+	return backendType
+}
+
+// Store satisfies the stash.Provider interface by
+// returning the backend.
+func (p *backendProvider) Store() store.StoreInterface {
+	return p.backend
+}
+
+// Close satisfies the stash.Provider interface, the
+// backend holds no resources.
+func (p *backendProvider) Close(_ context.Context) error {
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stashtest
+
+import (
+	"github.com/lacuna-seo/stash"
+	"sync"
+	"time"
+)
+
+// Clock defines a manually controlled clock used to
+// expire items in a Store without waiting. It is safe for
+// concurrent use and can be passed to
+// stash.WithMemoryClock.
+type Clock struct {
+	mtx sync.Mutex
+	now time.Time
+}
+
+var _ stash.Clock = (*Clock)(nil)
+
+// NewClock creates a new Clock set to now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to now.
+func (c *Clock) Set(now time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.now = now
+}
@@ -0,0 +1,477 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package stashtest provides utilities for testing code
+// that uses stash, and a conformance suite for Provider
+// implementations.
+package stashtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lacuna-seo/stash"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// RunProviderSuite runs the conformance suite against the
+// Provider returned by newProvider, checking it behaves
+// like the built-in providers when used through a
+// stash.Cache. newProvider is called for every test, the
+// providers returned may share the same backing store as
+// the cache is cleared before each test and closed after.
+//
+// The expiry test waits for items to expire in real time,
+// the backing store must expire items as time passes.
+func RunProviderSuite(t *testing.T, newProvider func() stash.Provider) {
+	tt := map[string]func(t *testing.T, c *stash.Cache){
+		"Provider":   testProvider,
+		"Missing":    testMissing,
+		"SetGet":     testSetGet,
+		"Delete":     testDelete,
+		"Exists":     testExists,
+		"AddReplace": testAddReplace,
+		"TTL":        testTTL,
+		"Expiry":     testExpiry,
+		"Grace":      testGrace,
+		"Tags":       testTags,
+		"Clear":      testClear,
+		"Namespace":  testNamespace,
+		"Batch":      testBatch,
+		"Absent":     testAbsent,
+		"Concurrent": testConcurrent,
+		"Remember":   testRemember,
+		"Close":      testClose,
+	}
+
+	for name, test := range tt {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			p := newProvider()
+			if !assert.NotNil(t, p, "expecting newProvider to return a Provider") {
+				return
+			}
+
+			c, err := stash.Load(p)
+			if !assert.NoError(t, err, "expecting Provider to load") {
+				return
+			}
+			defer c.Close(context.Background())
+
+			if !assert.NoError(t, c.Clear(context.Background())) {
+				return
+			}
+			test(t, c)
+		})
+	}
+}
+
+// testProvider checks the Provider's own methods.
+func testProvider(t *testing.T, c *stash.Cache) {
+	assert.NotEmpty(t, c.Driver, "expecting Provider to have a Driver")
+}
+
+// testMissing checks every lookup reports a missing key
+// with stash.ErrNotFound.
+func testMissing(t *testing.T, c *stash.Cache) {
+	ctx := context.Background()
+	var got string
+
+	assert.ErrorIs(t, c.Get(ctx, "missing", &got), stash.ErrNotFound)
+	_, err := c.GetWithTTL(ctx, "missing", &got)
+	assert.ErrorIs(t, err, stash.ErrNotFound)
+	_, err = c.TTL(ctx, "missing")
+	assert.ErrorIs(t, err, stash.ErrNotFound)
+	_, err = c.GetWithStaleness(ctx, "missing", &got)
+	assert.ErrorIs(t, err, stash.ErrNotFound)
+
+	results := c.GetMany(ctx, "missing")
+	assert.NoError(t, results.Err())
+	assert.ErrorIs(t, results[0].Err, stash.ErrNotFound)
+}
+
+// testSetGet checks values of different types round trip
+// and overwrite each other.
+func testSetGet(t *testing.T, c *stash.Cache) {
+	ctx := context.Background()
+
+	type item struct {
+		Name  string
+		Count int
+	}
+	want := item{Name: "stash", Count: 1}
+	assert.NoError(t, c.Set(ctx, "struct", want, stash.Options{Expiration: time.Hour}))
+	var got item
+	assert.NoError(t, c.Get(ctx, "struct", &got))
+	assert.Equal(t, want, got)
+
+	assert.NoError(t, c.Set(ctx, "bytes", []byte("stash"), stash.Options{Expiration: time.Hour}))
+	var buf []byte
+	assert.NoError(t, c.Get(ctx, "bytes", &buf))
+	assert.Equal(t, []byte("stash"), buf)
+
+	assert.NoError(t, c.Set(ctx, 1, "int key", stash.Options{Expiration: time.Hour}))
+	var s string
+	assert.NoError(t, c.Get(ctx, 1, &s))
+	assert.Equal(t, "int key", s)
+
+	assert.NoError(t, c.Set(ctx, 1, "overwritten", stash.Options{Expiration: time.Hour}))
+	assert.NoError(t, c.Get(ctx, 1, &s))
+	assert.Equal(t, "overwritten", s)
+}
+
+// testDelete checks deleted keys are missing and other
+// keys are untouched.
+func testDelete(t *testing.T, c *stash.Cache) {
+	ctx := context.Background()
+	assert.NoError(t, c.Set(ctx, "delete", "stash", stash.Options{Expiration: time.Hour}))
+	assert.NoError(t, c.Set(ctx, "keep", "stash", stash.Options{Expiration: time.Hour}))
+
+	assert.NoError(t, c.Delete(ctx, "delete"))
+	assert.ErrorIs(t, c.Get(ctx, "delete", new(string)), stash.ErrNotFound)
+	assert.NoError(t, c.Get(ctx, "keep", new(string)))
+}
+
+// testExists checks presence is reported per key in
+// order, including keys marked as absent.
+func testExists(t *testing.T, c *stash.Cache) {
+	ctx := context.Background()
+	assert.NoError(t, c.Set(ctx, "key", "stash", stash.Options{Expiration: time.Hour}))
+	assert.NoError(t, c.SetAbsent(ctx, "absent", stash.Options{Expiration: time.Hour}))
+
+	found, err := c.Exists(ctx, "key", "missing", "absent")
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false, true}, found)
+
+	found, err = c.Exists(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+// testAddReplace checks Add only stores missing keys and
+// Replace only stores existing keys, with their tags.
+func testAddReplace(t *testing.T, c *stash.Cache) {
+	ctx := context.Background()
+	options := stash.Options{Expiration: time.Hour, Tags: []string{"tag"}}
+
+	assert.ErrorIs(t, c.Replace(ctx, "key", "replaced", options), stash.ErrNotFound)
+	assert.ErrorIs(t, c.Get(ctx, "key", new(string)), stash.ErrNotFound)
+
+	assert.NoError(t, c.Add(ctx, "key", "added", options))
+	assert.ErrorIs(t, c.Add(ctx, "key", "again", options), stash.ErrKeyExists)
+	var got string
+	assert.NoError(t, c.Get(ctx, "key", &got))
+	assert.Equal(t, "added", got)
+
+	assert.NoError(t, c.Replace(ctx, "key", "replaced", options))
+	assert.NoError(t, c.Get(ctx, "key", &got))
+	assert.Equal(t, "replaced", got)
+	ttl, err := c.TTL(ctx, "key")
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(2*time.Second))
+
+	// Keys marked as absent exist.
+	assert.NoError(t, c.SetAbsent(ctx, "absent", stash.Options{Expiration: time.Hour}))
+	assert.ErrorIs(t, c.Add(ctx, "absent", "added", options), stash.ErrKeyExists)
+
+	assert.NoError(t, c.Add(ctx, "other", "added", options))
+	assert.NoError(t, c.Invalidate(ctx, stash.InvalidateOptions{Tags: []string{"tag"}}))
+	assert.ErrorIs(t, c.Get(ctx, "key", new(string)), stash.ErrNotFound)
+	assert.ErrorIs(t, c.Get(ctx, "other", new(string)), stash.ErrNotFound)
+}
+
+// testTTL checks the remaining time to live is reported
+// for expiring items and stash.NoExpiration for items kept
+// forever.
+func testTTL(t *testing.T, c *stash.Cache) {
+	ctx := context.Background()
+	assert.NoError(t, c.Set(ctx, "expiring", "stash", stash.Options{Expiration: time.Minute}))
+	assert.NoError(t, c.Set(ctx, "forever", "stash", stash.Options{Expiration: stash.RememberForever}))
+
+	var got string
+	ttl, err := c.GetWithTTL(ctx, "expiring", &got)
+	assert.NoError(t, err)
+	assert.Equal(t, "stash", got)
+	assert.InDelta(t, time.Minute, ttl, float64(2*time.Second))
+
+	ttl, err = c.TTL(ctx, "forever")
+	assert.NoError(t, err)
+	assert.Equal(t, stash.NoExpiration, ttl)
+
+	// Overwriting an expiring item with one kept forever
+	// removes its TTL.
+	forever := stash.Options{Expiration: stash.RememberForever}
+	assert.NoError(t, c.Set(ctx, "expiring", "stash", forever))
+	ttl, err = c.TTL(ctx, "expiring")
+	assert.NoError(t, err)
+	assert.Equal(t, stash.NoExpiration, ttl)
+
+	assert.NoError(t, c.Set(ctx, "batch", "stash", stash.Options{Expiration: time.Minute}))
+	assert.NoError(t, c.SetMany(ctx, stash.Item{Key: "batch", Value: "stash", Options: forever}).Err())
+	ttl, err = c.TTL(ctx, "batch")
+	assert.NoError(t, err)
+	assert.Equal(t, stash.NoExpiration, ttl)
+}
+
+// testExpiry checks items are removed once they expire.
+func testExpiry(t *testing.T, c *stash.Cache) {
+	ctx := context.Background()
+	assert.NoError(t, c.Set(ctx, "expiring", "stash", stash.Options{Expiration: time.Second}))
+	assert.NoError(t, c.Set(ctx, "forever", "stash", stash.Options{Expiration: stash.RememberForever}))
+	assert.NoError(t, c.Get(ctx, "expiring", new(string)))
+
+	assert.Eventually(t, func() bool {
+		return errors.Is(c.Get(ctx, "expiring", new(string)), stash.ErrNotFound)
+	}, 5*time.Second, 50*time.Millisecond, "expecting item to expire")
+	assert.NoError(t, c.Get(ctx, "forever", new(string)))
+}
+
+// testGrace checks items are served as stale once their
+// Expiration has passed until the Grace period ends.
+func testGrace(t *testing.T, c *stash.Cache) {
+	ctx := context.Background()
+	o := stash.Options{Expiration: 50 * time.Millisecond, Grace: time.Hour}
+	assert.NoError(t, c.Set(ctx, "key", "stash", o))
+	assert.NoError(t, c.SetMany(ctx, stash.Item{Key: "many", Value: "stash", Options: o}).Err())
+
+	var got string
+	stale, err := c.GetWithStaleness(ctx, "key", &got)
+	assert.NoError(t, err)
+	assert.False(t, stale)
+	assert.Equal(t, "stash", got)
+
+	time.Sleep(60 * time.Millisecond)
+
+	for _, key := range []string{"key", "many"} {
+		got = ""
+		stale, err = c.GetWithStaleness(ctx, key, &got)
+		assert.NoError(t, err)
+		assert.True(t, stale)
+		assert.Equal(t, "stash", got)
+
+		got = ""
+		assert.NoError(t, c.Get(ctx, key, &got))
+		assert.Equal(t, "stash", got)
+	}
+
+	got = ""
+	assert.NoError(t, c.GetMany(ctx, "many")[0].Decode(&got))
+	assert.Equal(t, "stash", got)
+
+	// Stale items have no time to live left.
+	ttl, err := c.TTL(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), ttl)
+}
+
+// testTags checks invalidating a tag removes every item
+// tagged with it and nothing else.
+func testTags(t *testing.T, c *stash.Cache) {
+	ctx := context.Background()
+	assert.NoError(t, c.Set(ctx, "a", "stash", stash.Options{Expiration: time.Hour, Tags: []string{"tag", "other"}}))
+	assert.NoError(t, c.Set(ctx, "b", "stash", stash.Options{Expiration: time.Hour, Tags: []string{"tag"}}))
+	assert.NoError(t, c.Set(ctx, "c", "stash", stash.Options{Expiration: time.Hour, Tags: []string{"other"}}))
+	assert.NoError(t, c.Set(ctx, "d", "stash", stash.Options{Expiration: time.Hour}))
+
+	assert.NoError(t, c.Invalidate(ctx, stash.InvalidateOptions{Tags: []string{"tag"}}))
+	assert.ErrorIs(t, c.Get(ctx, "a", new(string)), stash.ErrNotFound)
+	assert.ErrorIs(t, c.Get(ctx, "b", new(string)), stash.ErrNotFound)
+	assert.NoError(t, c.Get(ctx, "c", new(string)))
+	assert.NoError(t, c.Get(ctx, "d", new(string)))
+
+	assert.NoError(t, c.Invalidate(ctx, stash.InvalidateOptions{Tags: []string{"missing"}}))
+}
+
+// testClear checks Clear removes every item.
+func testClear(t *testing.T, c *stash.Cache) {
+	ctx := context.Background()
+	assert.NoError(t, c.Set(ctx, "a", "stash", stash.Options{Expiration: time.Hour}))
+	assert.NoError(t, c.Set(ctx, "b", "stash", stash.Options{Expiration: time.Hour, Tags: []string{"tag"}}))
+
+	assert.NoError(t, c.Clear(ctx))
+	assert.ErrorIs(t, c.Get(ctx, "a", new(string)), stash.ErrNotFound)
+	assert.ErrorIs(t, c.Get(ctx, "b", new(string)), stash.ErrNotFound)
+}
+
+// testNamespace checks namespaces are isolated from each
+// other and Clear only removes the namespace's items.
+func testNamespace(t *testing.T, c *stash.Cache) {
+	ctx := context.Background()
+	a, b := c.WithNamespace("a"), c.WithNamespace("b")
+	assert.NoError(t, a.Set(ctx, "key", "a", stash.Options{Expiration: time.Hour, Tags: []string{"tag"}}))
+	assert.NoError(t, b.Set(ctx, "key", "b", stash.Options{Expiration: time.Hour, Tags: []string{"tag"}}))
+	assert.NoError(t, c.Set(ctx, "key", "root", stash.Options{Expiration: time.Hour}))
+
+	var got string
+	assert.NoError(t, a.Get(ctx, "key", &got))
+	assert.Equal(t, "a", got)
+	assert.NoError(t, b.Get(ctx, "key", &got))
+	assert.Equal(t, "b", got)
+
+	assert.NoError(t, b.Invalidate(ctx, stash.InvalidateOptions{Tags: []string{"tag"}}))
+	assert.ErrorIs(t, b.Get(ctx, "key", &got), stash.ErrNotFound)
+	assert.NoError(t, a.Get(ctx, "key", &got))
+
+	assert.NoError(t, b.Set(ctx, "other", "b", stash.Options{Expiration: time.Hour}))
+	assert.NoError(t, b.Clear(ctx))
+	assert.ErrorIs(t, b.Get(ctx, "other", &got), stash.ErrNotFound)
+	assert.NoError(t, a.Get(ctx, "key", &got))
+
+	// Clear removes nested namespaces.
+	nested := a.WithNamespace("nested")
+	assert.NoError(t, nested.Set(ctx, "key", "nested", stash.Options{Expiration: time.Hour}))
+	assert.NoError(t, a.Clear(ctx))
+	assert.ErrorIs(t, a.Get(ctx, "key", &got), stash.ErrNotFound)
+	assert.ErrorIs(t, nested.Get(ctx, "key", &got), stash.ErrNotFound)
+	assert.NoError(t, c.Get(ctx, "key", &got))
+	assert.Equal(t, "root", got)
+}
+
+// testBatch checks SetMany, GetMany and DeleteMany report
+// a result per key in order.
+func testBatch(t *testing.T, c *stash.Cache) {
+	ctx := context.Background()
+	results := c.SetMany(ctx,
+		stash.Item{Key: "a", Value: "a", Options: stash.Options{Expiration: time.Hour}},
+		stash.Item{Key: "b", Value: "b", Options: stash.Options{Expiration: time.Hour, Tags: []string{"tag"}}},
+	)
+	assert.NoError(t, results.Err())
+	assert.Len(t, results, 2)
+
+	results = c.GetMany(ctx, "a", "missing", "b")
+	if !assert.Len(t, results, 3) {
+		return
+	}
+	var got string
+	assert.NoError(t, results[0].Decode(&got))
+	assert.Equal(t, "a", got)
+	assert.ErrorIs(t, results[1].Err, stash.ErrNotFound)
+	assert.NoError(t, results[2].Decode(&got))
+	assert.Equal(t, "b", got)
+
+	assert.NoError(t, c.Invalidate(ctx, stash.InvalidateOptions{Tags: []string{"tag"}}))
+	assert.ErrorIs(t, c.Get(ctx, "b", &got), stash.ErrNotFound)
+
+	assert.NoError(t, c.DeleteMany(ctx, "a").Err())
+	assert.ErrorIs(t, c.Get(ctx, "a", &got), stash.ErrNotFound)
+
+	// Deleting missing keys succeeds.
+	results = c.DeleteMany(ctx, "a", "missing")
+	assert.NoError(t, results.Err())
+	assert.NoError(t, results[0].Err)
+	assert.NoError(t, results[1].Err)
+	assert.NoError(t, c.Delete(ctx, "missing"))
+}
+
+// testAbsent checks tombstones are reported with
+// stash.ErrAbsent, tagged and replaced by Set.
+func testAbsent(t *testing.T, c *stash.Cache) {
+	ctx := context.Background()
+	o := stash.Options{Expiration: time.Hour, AbsentExpiration: time.Minute, Tags: []string{"tag"}}
+	assert.NoError(t, c.SetAbsent(ctx, "absent", o))
+
+	var got string
+	assert.ErrorIs(t, c.Get(ctx, "absent", &got), stash.ErrAbsent)
+	_, err := c.GetWithTTL(ctx, "absent", &got)
+	assert.ErrorIs(t, err, stash.ErrAbsent)
+	ttl, err := c.TTL(ctx, "absent")
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, ttl, time.Minute)
+
+	results := c.GetMany(ctx, "absent")
+	assert.ErrorIs(t, results[0].Err, stash.ErrAbsent)
+	assert.ErrorIs(t, results[0].Decode(&got), stash.ErrAbsent)
+
+	assert.NoError(t, c.Invalidate(ctx, stash.InvalidateOptions{Tags: []string{"tag"}}))
+	assert.ErrorIs(t, c.Get(ctx, "absent", &got), stash.ErrNotFound)
+
+	assert.NoError(t, c.SetAbsent(ctx, "absent", stash.Options{Expiration: time.Hour}))
+	assert.NoError(t, c.Set(ctx, "absent", "stash", stash.Options{Expiration: time.Hour}))
+	assert.NoError(t, c.Get(ctx, "absent", &got))
+	assert.Equal(t, "stash", got)
+}
+
+// testConcurrent checks the provider is safe for
+// concurrent use on both shared and distinct keys.
+func testConcurrent(t *testing.T, c *stash.Cache) {
+	ctx := context.Background()
+	const workers = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*4)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key-%d", i)
+			o := stash.Options{Expiration: time.Hour, Tags: []string{"tag"}}
+			errs <- c.Set(ctx, key, i, o)
+			errs <- c.Set(ctx, "shared", i, o)
+			var got int
+			errs <- c.Get(ctx, key, &got)
+			if got != i {
+				errs <- fmt.Errorf("expecting %d for %s, got %d", i, key, got)
+			}
+			errs <- c.Get(ctx, "shared", &got)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, c.Invalidate(ctx, stash.InvalidateOptions{Tags: []string{"tag"}}))
+	for i := 0; i < workers; i++ {
+		assert.ErrorIs(t, c.Get(ctx, fmt.Sprintf("key-%d", i), new(int)), stash.ErrNotFound)
+	}
+	assert.ErrorIs(t, c.Get(ctx, "shared", new(int)), stash.ErrNotFound)
+}
+
+// testRemember checks concurrent calls to Remember share a
+// single call to the loader and the result is stored.
+func testRemember(t *testing.T, c *stash.Cache) {
+	ctx := context.Background()
+	const workers = 10
+
+	var calls int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var got string
+			err := c.Remember(ctx, "remember", &got, stash.Options{Expiration: time.Hour}, func(ctx context.Context) (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "stash", nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, "stash", got)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	var got string
+	assert.NoError(t, c.Get(ctx, "remember", &got))
+	assert.Equal(t, "stash", got)
+}
+
+// testClose checks closing is idempotent and the cache
+// returns stash.ErrClosed once closed.
+func testClose(t *testing.T, c *stash.Cache) {
+	ctx := context.Background()
+	assert.NoError(t, c.Set(ctx, "key", "stash", stash.Options{Expiration: time.Hour}))
+	assert.NoError(t, c.Close(ctx))
+	assert.NoError(t, c.Close(ctx))
+	assert.ErrorIs(t, c.Get(ctx, "key", new(string)), stash.ErrClosed)
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stashtest
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/lacuna-seo/stash"
+	"github.com/lacuna-seo/stash/internal/memcachetest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	t.Parallel()
+	RunProviderSuite(t, func() stash.Provider {
+		return stash.NewMemory(time.Hour, time.Minute)
+	})
+}
+
+func TestRedis(t *testing.T) {
+	t.Parallel()
+	mr := runRedis(t)
+	RunProviderSuite(t, func() stash.Provider {
+		return stash.NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour)
+	})
+}
+
+func TestMemcache(t *testing.T) {
+	t.Parallel()
+	srv, err := memcachetest.New()
+	assert.NoError(t, err)
+	defer srv.Close()
+	RunProviderSuite(t, func() stash.Provider {
+		return stash.NewMemcache([]string{srv.Addr()}, time.Hour)
+	})
+}
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+	mr := runRedis(t)
+	RunProviderSuite(t, func() stash.Provider {
+		return stash.NewChain(time.Minute,
+			stash.NewMemory(time.Hour, time.Minute),
+			stash.NewRedis(redis.Options{Addr: mr.Addr()}, time.Hour),
+		)
+	})
+}
+
+// runRedis starts a miniredis server that expires keys as
+// time passes, miniredis only does so when fast forwarded.
+func runRedis(t *testing.T) *miniredis.Miniredis {
+	mr := miniredis.RunT(t)
+	ticker := time.NewTicker(10 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				mr.FastForward(10 * time.Millisecond)
+			case <-done:
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		ticker.Stop()
+		close(done)
+	})
+	return mr
+}
@@ -0,0 +1,398 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stashtest
+
+import (
+	"context"
+	"fmt"
+	"github.com/lacuna-seo/stash"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Call defines a single call made to a Store.
+type Call struct {
+	// Operation is the method called, such as
+	// stash.OperationGet.
+	Operation string
+	// Keys are the keys passed to the method, or the tags
+	// for Invalidate. They are empty for Clear.
+	Keys []interface{}
+	// Options are the options passed to Set, SetAbsent and
+	// Remember.
+	Options stash.Options
+	// Err is the error returned by the method, for batch
+	// operations it is the first error within the Results.
+	Err error
+}
+
+// Store defines a fully functional in-memory stash.Store
+// for unit tests. It records every call made to it, can be
+// told to fail operations for specific keys and expires
+// items using a Clock rather than the wall clock, so tests
+// never need to sleep. Values are marshalled and stored
+// exactly as they would be by a stash.Cache.
+//
+// Grace periods used for stale while revalidate are
+// measured with the wall clock.
+type Store struct {
+	cache    *stash.Cache
+	clock    *Clock
+	mtx      sync.Mutex
+	calls    []Call
+	failures map[failure]error
+}
+
+// failure defines an operation to fail, for a key or for
+// every key.
+type failure struct {
+	operation string
+	key       string
+	any       bool
+}
+
+var _ stash.Store = (*Store)(nil)
+
+// NewStore creates a new empty Store with a Clock set to
+// the current time.
+func NewStore() *Store {
+	clock := NewClock(time.Now())
+	// Loading the backend provider cannot fail, it has no
+	// environment to validate.
+	c, _ := stash.Load(&backendProvider{backend: newBackend(clock)})
+	return &Store{
+		cache:    c,
+		clock:    clock,
+		failures: make(map[failure]error),
+	}
+}
+
+// Clock returns the clock used to expire items, advance
+// it to expire them.
+func (s *Store) Clock() *Clock {
+	return s.clock
+}
+
+// Fail causes the operation (such as stash.OperationGet)
+// to return err for the key, or for every key if key is
+// nil. For Invalidate the key is a tag. Pass a nil err to
+// stop failing.
+func (s *Store) Fail(operation string, key interface{}, err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	f := failure{operation: operation, any: key == nil}
+	if key != nil {
+		f.key = fmt.Sprint(key)
+	}
+	if err == nil {
+		delete(s.failures, f)
+		return
+	}
+	s.failures[f] = err
+}
+
+// Calls returns every call made to the Store, in order.
+func (s *Store) Calls() []Call {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	calls := make([]Call, len(s.calls))
+	copy(calls, s.calls)
+	return calls
+}
+
+// Reset removes the calls recorded, the items stored and
+// the failures are untouched.
+func (s *Store) Reset() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.calls = nil
+}
+
+// AssertCached asserts the key is stored and its value is
+// equal to want, the value is unmarshalled into a new
+// value of want's type. The call is not recorded.
+func (s *Store) AssertCached(t assert.TestingT, key, want interface{}) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	if want == nil {
+		return assert.Fail(t, "expecting a non nil value to compare against")
+	}
+	v := reflect.New(reflect.TypeOf(want))
+	err := s.cache.Get(context.Background(), key, v.Interface())
+	if !assert.NoError(t, err, "expecting %v to be cached", key) {
+		return false
+	}
+	return assert.Equal(t, want, v.Elem().Interface(), "expecting the value cached for %v to be equal", key)
+}
+
+// AssertNotCached asserts the key is not stored, or has
+// expired. The call is not recorded.
+func (s *Store) AssertNotCached(t assert.TestingT, key interface{}) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	_, err := s.cache.TTL(context.Background(), key)
+	return assert.ErrorIs(t, err, stash.ErrNotFound, "expecting %v not to be cached", key)
+}
+
+// AssertInvalidated asserts the tag has been passed to a
+// successful call to Invalidate.
+func (s *Store) AssertInvalidated(t assert.TestingT, tag string) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	for _, call := range s.Calls() {
+		if call.Operation != stash.OperationInvalidate || call.Err != nil {
+			continue
+		}
+		for _, key := range call.Keys {
+			if key == tag {
+				return true
+			}
+		}
+	}
+	return assert.Fail(t, fmt.Sprintf("expecting tag %q to be invalidated", tag))
+}
+
+// Get satisfies the stash.Store interface.
+func (s *Store) Get(ctx context.Context, key, v interface{}) error {
+	err := s.fail(stash.OperationGet, key)
+	if err == nil {
+		err = s.cache.Get(ctx, key, v)
+	}
+	s.record(Call{Operation: stash.OperationGet, Keys: []interface{}{key}, Err: err})
+	return err
+}
+
+// GetWithTTL satisfies the stash.Store interface.
+func (s *Store) GetWithTTL(ctx context.Context, key, v interface{}) (time.Duration, error) {
+	var ttl time.Duration
+	err := s.fail(stash.OperationGetWithTTL, key)
+	if err == nil {
+		ttl, err = s.cache.GetWithTTL(ctx, key, v)
+	}
+	s.record(Call{Operation: stash.OperationGetWithTTL, Keys: []interface{}{key}, Err: err})
+	return ttl, err
+}
+
+// TTL satisfies the stash.Store interface.
+func (s *Store) TTL(ctx context.Context, key interface{}) (time.Duration, error) {
+	var ttl time.Duration
+	err := s.fail(stash.OperationTTL, key)
+	if err == nil {
+		ttl, err = s.cache.TTL(ctx, key)
+	}
+	s.record(Call{Operation: stash.OperationTTL, Keys: []interface{}{key}, Err: err})
+	return ttl, err
+}
+
+// GetWithStaleness satisfies the stash.Store interface,
+// failures for stash.OperationGet apply.
+func (s *Store) GetWithStaleness(ctx context.Context, key, v interface{}) (bool, error) {
+	var stale bool
+	err := s.fail(stash.OperationGet, key)
+	if err == nil {
+		stale, err = s.cache.GetWithStaleness(ctx, key, v)
+	}
+	s.record(Call{Operation: stash.OperationGet, Keys: []interface{}{key}, Err: err})
+	return stale, err
+}
+
+// Set satisfies the stash.Store interface.
+func (s *Store) Set(ctx context.Context, key interface{}, value interface{}, options stash.Options) error {
+	err := s.fail(stash.OperationSet, key)
+	if err == nil {
+		err = s.cache.Set(ctx, key, value, options)
+	}
+	s.record(Call{Operation: stash.OperationSet, Keys: []interface{}{key}, Options: options, Err: err})
+	return err
+}
+
+// Add satisfies the stash.Store interface.
+func (s *Store) Add(ctx context.Context, key interface{}, value interface{}, options stash.Options) error {
+	err := s.fail(stash.OperationAdd, key)
+	if err == nil {
+		err = s.cache.Add(ctx, key, value, options)
+	}
+	s.record(Call{Operation: stash.OperationAdd, Keys: []interface{}{key}, Options: options, Err: err})
+	return err
+}
+
+// Replace satisfies the stash.Store interface.
+func (s *Store) Replace(ctx context.Context, key interface{}, value interface{}, options stash.Options) error {
+	err := s.fail(stash.OperationReplace, key)
+	if err == nil {
+		err = s.cache.Replace(ctx, key, value, options)
+	}
+	s.record(Call{Operation: stash.OperationReplace, Keys: []interface{}{key}, Options: options, Err: err})
+	return err
+}
+
+// SetAbsent satisfies the stash.Store interface.
+func (s *Store) SetAbsent(ctx context.Context, key interface{}, options stash.Options) error {
+	err := s.fail(stash.OperationSetAbsent, key)
+	if err == nil {
+		err = s.cache.SetAbsent(ctx, key, options)
+	}
+	s.record(Call{Operation: stash.OperationSetAbsent, Keys: []interface{}{key}, Options: options, Err: err})
+	return err
+}
+
+// Delete satisfies the stash.Store interface.
+func (s *Store) Delete(ctx context.Context, key interface{}) error {
+	err := s.fail(stash.OperationDelete, key)
+	if err == nil {
+		err = s.cache.Delete(ctx, key)
+	}
+	s.record(Call{Operation: stash.OperationDelete, Keys: []interface{}{key}, Err: err})
+	return err
+}
+
+// Exists satisfies the stash.Store interface, a failure
+// for any of the keys fails the call.
+func (s *Store) Exists(ctx context.Context, keys ...interface{}) ([]bool, error) {
+	var err error
+	for _, key := range keys {
+		if err = s.fail(stash.OperationExists, key); err != nil {
+			break
+		}
+	}
+	var found []bool
+	if err == nil {
+		found, err = s.cache.Exists(ctx, keys...)
+	}
+	s.record(Call{Operation: stash.OperationExists, Keys: keys, Err: err})
+	return found, err
+}
+
+// GetMany satisfies the stash.Store interface.
+func (s *Store) GetMany(ctx context.Context, keys ...interface{}) stash.Results {
+	results := s.cache.GetMany(ctx, keys...)
+	for i, key := range keys {
+		if err := s.fail(stash.OperationGetMany, key); err != nil {
+			results[i] = stash.Result{Key: key, Err: err}
+		}
+	}
+	s.record(Call{Operation: stash.OperationGetMany, Keys: keys, Err: results.Err()})
+	return results
+}
+
+// SetMany satisfies the stash.Store interface, items that
+// are failed are not stored.
+func (s *Store) SetMany(ctx context.Context, items ...stash.Item) stash.Results {
+	results := make(stash.Results, len(items))
+	keys := make([]interface{}, len(items))
+	store := make([]stash.Item, 0, len(items))
+	index := make([]int, 0, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+		if err := s.fail(stash.OperationSetMany, item.Key); err != nil {
+			results[i] = stash.Result{Key: item.Key, Err: err}
+			continue
+		}
+		store = append(store, item)
+		index = append(index, i)
+	}
+	for i, result := range s.cache.SetMany(ctx, store...) {
+		results[index[i]] = result
+	}
+	s.record(Call{Operation: stash.OperationSetMany, Keys: keys, Err: results.Err()})
+	return results
+}
+
+// DeleteMany satisfies the stash.Store interface, keys
+// that are failed are not removed.
+func (s *Store) DeleteMany(ctx context.Context, keys ...interface{}) stash.Results {
+	results := make(stash.Results, len(keys))
+	remove := make([]interface{}, 0, len(keys))
+	index := make([]int, 0, len(keys))
+	for i, key := range keys {
+		if err := s.fail(stash.OperationDeleteMany, key); err != nil {
+			results[i] = stash.Result{Key: key, Err: err}
+			continue
+		}
+		remove = append(remove, key)
+		index = append(index, i)
+	}
+	for i, result := range s.cache.DeleteMany(ctx, remove...) {
+		results[index[i]] = result
+	}
+	s.record(Call{Operation: stash.OperationDeleteMany, Keys: keys, Err: results.Err()})
+	return results
+}
+
+// Invalidate satisfies the stash.Store interface, the
+// tags are recorded as the call's keys.
+func (s *Store) Invalidate(ctx context.Context, options stash.InvalidateOptions) error {
+	tags := make([]interface{}, len(options.Tags))
+	var err error
+	for i, tag := range options.Tags {
+		tags[i] = tag
+		if err == nil {
+			err = s.fail(stash.OperationInvalidate, tag)
+		}
+	}
+	if err == nil {
+		err = s.fail(stash.OperationInvalidate, nil)
+	}
+	if err == nil {
+		err = s.cache.Invalidate(ctx, options)
+	}
+	s.record(Call{Operation: stash.OperationInvalidate, Keys: tags, Err: err})
+	return err
+}
+
+// Clear satisfies the stash.Store interface.
+func (s *Store) Clear(ctx context.Context) error {
+	err := s.fail(stash.OperationClear, nil)
+	if err == nil {
+		err = s.cache.Clear(ctx)
+	}
+	s.record(Call{Operation: stash.OperationClear, Err: err})
+	return err
+}
+
+// Remember satisfies the stash.Store interface.
+func (s *Store) Remember(ctx context.Context, key, v interface{}, options stash.Options, loader func(ctx context.Context) (interface{}, error)) error {
+	err := s.fail(stash.OperationRemember, key)
+	if err == nil {
+		err = s.cache.Remember(ctx, key, v, options, loader)
+	}
+	s.record(Call{Operation: stash.OperationRemember, Keys: []interface{}{key}, Options: options, Err: err})
+	return err
+}
+
+// Close satisfies the stash.Store interface, the Store
+// returns stash.ErrClosed once closed. The call is not
+// recorded.
+func (s *Store) Close(ctx context.Context) error {
+	return s.cache.Close(ctx)
+}
+
+// fail returns the error set via Fail for the operation
+// and key, if any.
+func (s *Store) fail(operation string, key interface{}) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if len(s.failures) == 0 {
+		return nil
+	}
+	if key != nil {
+		if err, ok := s.failures[failure{operation: operation, key: fmt.Sprint(key)}]; ok {
+			return err
+		}
+	}
+	return s.failures[failure{operation: operation, any: true}]
+}
+
+// record appends a call to the calls made.
+func (s *Store) record(call Call) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.calls = append(s.calls, call)
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stashtest
+
+import (
+	"context"
+	"errors"
+	"github.com/lacuna-seo/stash"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore()
+	ctx := context.Background()
+
+	assert.NoError(t, s.Set(ctx, "key", "stash", stash.Options{Expiration: time.Minute, Tags: []string{"tag"}}))
+	assert.NoError(t, s.Set(ctx, "forever", 1, stash.Options{}))
+	s.AssertCached(t, "key", "stash")
+	s.AssertCached(t, "forever", 1)
+
+	found, err := s.Exists(ctx, "key", "missing")
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false}, found)
+
+	ttl, err := s.TTL(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, ttl)
+	ttl, err = s.TTL(ctx, "forever")
+	assert.NoError(t, err)
+	assert.Equal(t, stash.NoExpiration, ttl)
+
+	s.Clock().Advance(time.Minute)
+	s.AssertNotCached(t, "key")
+	assert.ErrorIs(t, s.Get(ctx, "key", new(string)), stash.ErrNotFound)
+	s.AssertCached(t, "forever", 1)
+
+	assert.NoError(t, s.Set(ctx, "key", "stash", stash.Options{Tags: []string{"tag"}}))
+	assert.NoError(t, s.Invalidate(ctx, stash.InvalidateOptions{Tags: []string{"tag"}}))
+	s.AssertInvalidated(t, "tag")
+	s.AssertNotCached(t, "key")
+
+	calls := s.Calls()
+	assert.Len(t, calls, 8)
+	assert.Equal(t, Call{
+		Operation: stash.OperationSet,
+		Keys:      []interface{}{"key"},
+		Options:   stash.Options{Expiration: time.Minute, Tags: []string{"tag"}},
+	}, calls[0])
+	assert.Equal(t, stash.OperationGet, calls[5].Operation)
+	assert.ErrorIs(t, calls[5].Err, stash.ErrNotFound)
+
+	s.Reset()
+	assert.Empty(t, s.Calls())
+
+	assert.NoError(t, s.Close(ctx))
+	assert.ErrorIs(t, s.Get(ctx, "forever", new(int)), stash.ErrClosed)
+}
+
+func TestStore_Fail(t *testing.T) {
+	s := NewStore()
+	ctx := context.Background()
+	fail := errors.New("fail")
+
+	s.Fail(stash.OperationSet, "key", fail)
+	assert.ErrorIs(t, s.Set(ctx, "key", "stash", stash.Options{}), fail)
+	assert.NoError(t, s.Set(ctx, "other", "stash", stash.Options{}))
+	s.AssertNotCached(t, "key")
+
+	s.Fail(stash.OperationSet, "key", nil)
+	assert.NoError(t, s.Set(ctx, "key", "stash", stash.Options{}))
+
+	s.Fail(stash.OperationGet, nil, fail)
+	assert.ErrorIs(t, s.Get(ctx, "key", new(string)), fail)
+	assert.ErrorIs(t, s.Get(ctx, "other", new(string)), fail)
+	s.Fail(stash.OperationGet, nil, nil)
+
+	s.Fail(stash.OperationGetMany, "key", fail)
+	results := s.GetMany(ctx, "key", "other", "missing")
+	assert.ErrorIs(t, results.Err(), fail)
+	var got string
+	assert.NoError(t, results[1].Decode(&got))
+	assert.Equal(t, "stash", got)
+	assert.ErrorIs(t, results[2].Err, stash.ErrNotFound)
+
+	s.Fail(stash.OperationSetMany, "a", fail)
+	results = s.SetMany(ctx, stash.Item{Key: "a", Value: "a"}, stash.Item{Key: "b", Value: "b"})
+	assert.ErrorIs(t, results[0].Err, fail)
+	assert.NoError(t, results[1].Err)
+	s.AssertNotCached(t, "a")
+	s.AssertCached(t, "b", "b")
+
+	s.Fail(stash.OperationDeleteMany, "b", fail)
+	results = s.DeleteMany(ctx, "b", "other")
+	assert.ErrorIs(t, results[0].Err, fail)
+	assert.NoError(t, results[1].Err)
+	s.AssertCached(t, "b", "b")
+	s.AssertNotCached(t, "other")
+
+	s.Fail(stash.OperationInvalidate, "tag", fail)
+	assert.ErrorIs(t, s.Invalidate(ctx, stash.InvalidateOptions{Tags: []string{"tag"}}), fail)
+
+	s.Fail(stash.OperationExists, "b", fail)
+	_, err := s.Exists(ctx, "a", "b")
+	assert.ErrorIs(t, err, fail)
+
+	s.Fail(stash.OperationClear, nil, fail)
+	assert.ErrorIs(t, s.Clear(ctx), fail)
+	s.AssertCached(t, "b", "b")
+}
+
+func TestStore_Assertions(t *testing.T) {
+	s := NewStore()
+	ctx := context.Background()
+	assert.NoError(t, s.Set(ctx, "key", "stash", stash.Options{}))
+
+	mt := &mockT{}
+	assert.False(t, s.AssertCached(mt, "key", "other"))
+	assert.False(t, s.AssertCached(mt, "missing", "stash"))
+	assert.False(t, s.AssertNotCached(mt, "key"))
+	assert.False(t, s.AssertInvalidated(mt, "tag"))
+	assert.Equal(t, 4, mt.failed)
+}
+
+// mockT is an assert.TestingT that counts failures.
+type mockT struct {
+	failed int
+}
+
+func (m *mockT) Errorf(string, ...interface{}) {
+	m.failed++
+}
@@ -4,7 +4,10 @@
 
 package stasher
 
-import "github.com/eko/gocache/v2/store"
+import (
+	"context"
+	"github.com/eko/gocache/v2/store"
+)
 
 // StoreInterface used for mocking.
 type StoreInterface interface {
@@ -17,4 +20,5 @@ type Provider interface {
 	Validate() error
 	Driver() string
 	Store() store.StoreInterface
+	Close(ctx context.Context) error
 }
@@ -0,0 +1,147 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tracing provides OpenTelemetry spans for the
+// operations performed by a stash Cache.
+package tracing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/lacuna-seo/stash"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the tracer used to
+// create spans.
+const InstrumentationName = "github.com/lacuna-seo/stash"
+
+const (
+	// DriverKey is the attribute for the Driver of the
+	// Cache.
+	DriverKey = attribute.Key("stash.driver")
+	// KeyKey is the attribute for the key of single key
+	// operations.
+	KeyKey = attribute.Key("stash.key")
+	// KeysKey is the attribute for the keys of batch
+	// operations.
+	KeysKey = attribute.Key("stash.keys")
+	// HitKey is the attribute reporting whether a single
+	// key lookup found the key.
+	HitKey = attribute.Key("stash.hit")
+	// HitsKey is the attribute for the amount of keys
+	// found by GetMany.
+	HitsKey = attribute.Key("stash.hits")
+	// MissesKey is the attribute for the amount of keys
+	// not found by GetMany.
+	MissesKey = attribute.Key("stash.misses")
+	// SizeKey is the attribute for the amount of bytes
+	// read from or written to the store.
+	SizeKey = attribute.Key("stash.size")
+)
+
+// Tracer defines a stash.Instrumentation that starts a
+// span for every operation performed through a Cache.
+// Spans are named after the operation, for example
+// "stash.get", and are children of the span within the
+// context passed to the Cache.
+type Tracer struct {
+	tracer   trace.Tracer
+	hashKeys bool
+}
+
+// Option defines a function for configuring the Tracer.
+type Option func(t *Tracer)
+
+// WithTracerProvider sets the provider used to create
+// the tracer, the global provider is used by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(t *Tracer) {
+		t.tracer = tp.Tracer(InstrumentationName)
+	}
+}
+
+// WithHashedKeys records the SHA-256 hash of keys rather
+// than the keys themselves, for keys that may contain
+// personal or sensitive information.
+func WithHashedKeys() Option {
+	return func(t *Tracer) {
+		t.hashKeys = true
+	}
+}
+
+// NewTracer creates a new Tracer to pass to
+// stash.WithInstrumentation.
+func NewTracer(opts ...Option) *Tracer {
+	t := &Tracer{
+		tracer: otel.Tracer(InstrumentationName),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Start starts the span for the operation, it satisfies
+// the stash.OperationStarter interface.
+func (t *Tracer) Start(ctx context.Context, operation string) context.Context {
+	ctx, _ = t.tracer.Start(ctx, "stash."+operation, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx
+}
+
+// Observe records the outcome of the operation and ends
+// the span started by Start, it satisfies the
+// stash.Instrumentation interface.
+func (t *Tracer) Observe(ctx context.Context, e stash.Event) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	defer span.End()
+
+	attrs := []attribute.KeyValue{
+		DriverKey.String(e.Driver),
+		SizeKey.Int(e.Size),
+	}
+
+	switch len(e.Keys) {
+	case 0:
+	case 1:
+		attrs = append(attrs, KeyKey.String(t.key(e.Keys[0])))
+	default:
+		keys := make([]string, len(e.Keys))
+		for i, key := range e.Keys {
+			keys[i] = t.key(key)
+		}
+		attrs = append(attrs, KeysKey.Array(keys))
+	}
+
+	switch e.Operation {
+	case stash.OperationGet, stash.OperationGetWithTTL, stash.OperationTTL, stash.OperationRemember:
+		attrs = append(attrs, HitKey.Bool(e.Hits > 0))
+	case stash.OperationGetMany:
+		attrs = append(attrs, HitsKey.Int(e.Hits), MissesKey.Int(e.Misses))
+	}
+
+	span.SetAttributes(attrs...)
+
+	if e.Err != nil {
+		span.RecordError(e.Err)
+		span.SetStatus(codes.Error, e.Err.Error())
+	}
+}
+
+// key returns the key to record, hashed if WithHashedKeys
+// is set.
+func (t *Tracer) key(key string) string {
+	if !t.hashKeys {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tracing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/lacuna-seo/stash"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/oteltest"
+	"testing"
+	"time"
+)
+
+func TestTracer(t *testing.T) {
+	sr := new(oteltest.SpanRecorder)
+	tp := oteltest.NewTracerProvider(oteltest.WithSpanRecorder(sr))
+
+	c, err := stash.Load(stash.NewMemory(time.Hour, time.Hour), stash.WithInstrumentation(NewTracer(WithTracerProvider(tp))))
+	assert.NoError(t, err)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	var got string
+	assert.NoError(t, c.Set(ctx, "key", "value", stash.Options{}))
+	assert.NoError(t, c.Get(ctx, "key", &got))
+	assert.ErrorIs(t, c.Get(ctx, "missing", &got), stash.ErrNotFound)
+	c.GetMany(ctx, "key", "missing")
+	assert.Error(t, c.Set(ctx, "error", make(chan int), stash.Options{}))
+	assert.NoError(t, c.Clear(ctx))
+	parent.End()
+
+	spans := sr.Completed()
+	assert.Len(t, spans, 7)
+	for _, span := range spans[:6] {
+		assert.Equal(t, parent.SpanContext().SpanID(), span.ParentSpanID())
+		assert.Equal(t, attribute.StringValue(stash.MemoryDriver), span.Attributes()[DriverKey])
+	}
+
+	set := spans[0]
+	assert.Equal(t, "stash.set", set.Name())
+	assert.Equal(t, attribute.StringValue("key"), set.Attributes()[KeyKey])
+	assert.Greater(t, set.Attributes()[SizeKey].AsInt64(), int64(0))
+
+	hit := spans[1]
+	assert.Equal(t, "stash.get", hit.Name())
+	assert.Equal(t, attribute.BoolValue(true), hit.Attributes()[HitKey])
+
+	miss := spans[2]
+	assert.Equal(t, attribute.BoolValue(false), miss.Attributes()[HitKey])
+	assert.Equal(t, codes.Unset, miss.StatusCode())
+
+	many := spans[3]
+	assert.Equal(t, "stash.get_many", many.Name())
+	assert.Equal(t, attribute.ArrayValue([]string{"key", "missing"}), many.Attributes()[KeysKey])
+	assert.Equal(t, attribute.IntValue(1), many.Attributes()[HitsKey])
+	assert.Equal(t, attribute.IntValue(1), many.Attributes()[MissesKey])
+
+	errored := spans[4]
+	assert.Equal(t, codes.Error, errored.StatusCode())
+	assert.Len(t, errored.Events(), 1)
+
+	assert.Equal(t, "stash.clear", spans[5].Name())
+	_, ok := spans[5].Attributes()[KeyKey]
+	assert.False(t, ok)
+}
+
+func TestTracer_WithHashedKeys(t *testing.T) {
+	sr := new(oteltest.SpanRecorder)
+	tp := oteltest.NewTracerProvider(oteltest.WithSpanRecorder(sr))
+
+	c, err := stash.Load(stash.NewMemory(time.Hour, time.Hour), stash.WithInstrumentation(NewTracer(WithTracerProvider(tp), WithHashedKeys())))
+	assert.NoError(t, err)
+
+	var got string
+	assert.ErrorIs(t, c.Get(context.Background(), "secret", &got), stash.ErrNotFound)
+
+	sum := sha256.Sum256([]byte("secret"))
+	spans := sr.Completed()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, attribute.StringValue(hex.EncodeToString(sum[:])), spans[0].Attributes()[KeyKey])
+}
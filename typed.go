@@ -0,0 +1,197 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// TypedCache defines a type safe wrapper around a Store,
+// keys are of type K and values are of type V, removing
+// the need to declare and pass pointers when calling Get.
+type TypedCache[K comparable, V any] struct {
+	store Store
+}
+
+// NewTypedCache creates a new TypedCache from a Store,
+// which is typically a *Cache returned by Load.
+func NewTypedCache[K comparable, V any](s Store) *TypedCache[K, V] {
+	return &TypedCache[K, V]{
+		store: s,
+	}
+}
+
+// Get retrieves a specific item from the cache by key.
+// Returns ErrNotFound if the key does not exist.
+func (t *TypedCache[K, V]) Get(ctx context.Context, key K) (V, error) {
+	var v V
+	err := t.store.Get(ctx, key, &v)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return v, nil
+}
+
+// GetWithTTL retrieves a specific item from the cache by key
+// and returns its remaining time to live. NoExpiration is
+// returned if the item does not expire.
+// Returns ErrNotFound if the key does not exist.
+func (t *TypedCache[K, V]) GetWithTTL(ctx context.Context, key K) (V, time.Duration, error) {
+	var v V
+	ttl, err := t.store.GetWithTTL(ctx, key, &v)
+	if err != nil {
+		var zero V
+		return zero, 0, err
+	}
+	return v, ttl, nil
+}
+
+// TTL returns the remaining time to live of an item.
+// Returns ErrNotFound if the key does not exist.
+func (t *TypedCache[K, V]) TTL(ctx context.Context, key K) (time.Duration, error) {
+	return t.store.TTL(ctx, key)
+}
+
+// GetWithStaleness retrieves a specific item from the cache
+// by key and reports whether it is stale.
+// Returns ErrNotFound if the key does not exist.
+func (t *TypedCache[K, V]) GetWithStaleness(ctx context.Context, key K) (V, bool, error) {
+	var v V
+	stale, err := t.store.GetWithStaleness(ctx, key, &v)
+	if err != nil {
+		var zero V
+		return zero, false, err
+	}
+	return v, stale, nil
+}
+
+// Set stores a singular item in the cache by key, value
+// and options (tags and expiration time).
+func (t *TypedCache[K, V]) Set(ctx context.Context, key K, value V, options Options) error {
+	return t.store.Set(ctx, key, value, options)
+}
+
+// Add stores the item only if the key does not exist,
+// returning ErrKeyExists if it does.
+func (t *TypedCache[K, V]) Add(ctx context.Context, key K, value V, options Options) error {
+	return t.store.Add(ctx, key, value, options)
+}
+
+// Replace stores the item only if the key exists,
+// returning ErrNotFound if it does not.
+func (t *TypedCache[K, V]) Replace(ctx context.Context, key K, value V, options Options) error {
+	return t.store.Replace(ctx, key, value, options)
+}
+
+// SetAbsent stores a tombstone for the key, Get returns
+// ErrAbsent for the key until the tombstone expires.
+func (t *TypedCache[K, V]) SetAbsent(ctx context.Context, key K, options Options) error {
+	return t.store.SetAbsent(ctx, key, options)
+}
+
+// Delete removes a singular item from the cache by
+// a specific key.
+func (t *TypedCache[K, V]) Delete(ctx context.Context, key K) error {
+	return t.store.Delete(ctx, key)
+}
+
+// Exists reports whether each key is stored, in the
+// same order as the keys passed, without unmarshalling
+// the values.
+func (t *TypedCache[K, V]) Exists(ctx context.Context, keys ...K) ([]bool, error) {
+	k := make([]interface{}, len(keys))
+	for i, key := range keys {
+		k[i] = key
+	}
+	return t.store.Exists(ctx, k...)
+}
+
+// GetMany retrieves multiple items from the cache by key,
+// keys that do not exist or are known to be absent are
+// omitted from the map. The first error that is not
+// ErrNotFound or ErrAbsent is returned.
+func (t *TypedCache[K, V]) GetMany(ctx context.Context, keys ...K) (map[K]V, error) {
+	ikeys := make([]interface{}, len(keys))
+	for i, key := range keys {
+		ikeys[i] = key
+	}
+
+	values := make(map[K]V, len(keys))
+	for i, result := range t.store.GetMany(ctx, ikeys...) {
+		var v V
+		err := result.Decode(&v)
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrAbsent) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[keys[i]] = v
+	}
+
+	return values, nil
+}
+
+// SetMany stores multiple items in the cache with the
+// same options. The first error is returned.
+func (t *TypedCache[K, V]) SetMany(ctx context.Context, items map[K]V, options Options) error {
+	batch := make([]Item, 0, len(items))
+	for key, value := range items {
+		batch = append(batch, Item{Key: key, Value: value, Options: options})
+	}
+	return t.store.SetMany(ctx, batch...).Err()
+}
+
+// DeleteMany removes multiple items from the cache by
+// key. The first error is returned.
+func (t *TypedCache[K, V]) DeleteMany(ctx context.Context, keys ...K) error {
+	ikeys := make([]interface{}, len(keys))
+	for i, key := range keys {
+		ikeys[i] = key
+	}
+	return t.store.DeleteMany(ctx, ikeys...).Err()
+}
+
+// Invalidate removes items from the cache via the
+// InvalidateOptions passed.
+func (t *TypedCache[K, V]) Invalidate(ctx context.Context, options InvalidateOptions) error {
+	return t.store.Invalidate(ctx, options)
+}
+
+// Clear removes all items from the cache.
+func (t *TypedCache[K, V]) Clear(ctx context.Context) error {
+	return t.store.Clear(ctx)
+}
+
+// Close waits for operations in flight to finish and
+// releases the resources owned by the underlying Store.
+func (t *TypedCache[K, V]) Close(ctx context.Context) error {
+	return t.store.Close(ctx)
+}
+
+// Store returns the underlying Store the TypedCache
+// wraps.
+func (t *TypedCache[K, V]) Store() Store {
+	return t.store
+}
+
+// Remember retrieves an item from the cache by key, if the
+// item does not exist the loader is called and the result
+// is stored with the options passed. Concurrent calls for
+// the same key share a single call to the loader.
+func (t *TypedCache[K, V]) Remember(ctx context.Context, key K, options Options, loader func(ctx context.Context) (V, error)) (V, error) {
+	var v V
+	err := t.store.Remember(ctx, key, &v, options, func(ctx context.Context) (interface{}, error) {
+		return loader(ctx)
+	})
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return v, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 The Reddico Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stash
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type typedItem struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func (t *StashTestSuite) TestTypedCache() {
+	c, err := Load(NewMemory(time.Hour, time.Hour))
+	t.NoError(err)
+
+	ctx := context.Background()
+	tc := NewTypedCache[int, typedItem](c)
+	t.Equal(c, tc.Store())
+
+	_, err = tc.Get(ctx, 1)
+	t.ErrorIs(err, ErrNotFound)
+
+	want := typedItem{Name: "stash", Count: 2}
+	t.NoError(tc.Set(ctx, 1, want, Options{Tags: []string{"items"}}))
+
+	got, err := tc.Get(ctx, 1)
+	t.NoError(err)
+	t.Equal(want, got)
+
+	t.NoError(tc.Delete(ctx, 1))
+	_, err = tc.Get(ctx, 1)
+	t.ErrorIs(err, ErrNotFound)
+
+	t.NoError(tc.Set(ctx, 2, want, Options{Tags: []string{"items"}}))
+	t.NoError(tc.Invalidate(ctx, InvalidateOptions{Tags: []string{"items"}}))
+	_, err = tc.Get(ctx, 2)
+	t.ErrorIs(err, ErrNotFound)
+
+	t.NoError(tc.Set(ctx, 3, want, Options{}))
+	t.NoError(tc.Clear(ctx))
+	_, err = tc.Get(ctx, 3)
+	t.ErrorIs(err, ErrNotFound)
+}
+
+func (t *StashTestSuite) TestTypedCache_DecodeError() {
+	c, err := Load(NewMemory(time.Hour, time.Hour))
+	t.NoError(err)
+
+	ctx := context.Background()
+	t.NoError(c.Set(ctx, "key", "string", Options{}))
+
+	got, err := NewTypedCache[string, int](c).Get(ctx, "key")
+	t.Error(err)
+	t.Equal(0, got)
+}
+
+func (t *StashTestSuite) TestTypedCache_Remember() {
+	c, err := Load(NewMemory(time.Hour, time.Hour))
+	t.NoError(err)
+
+	ctx := context.Background()
+	tc := NewTypedCache[string, typedItem](c)
+	want := typedItem{Name: "stash", Count: 1}
+
+	got, err := tc.Remember(ctx, "key", Options{}, func(ctx context.Context) (typedItem, error) {
+		return want, nil
+	})
+	t.NoError(err)
+	t.Equal(want, got)
+
+	got, err = tc.Remember(ctx, "key", Options{}, func(ctx context.Context) (typedItem, error) {
+		return typedItem{}, errors.New("loader should not be called")
+	})
+	t.NoError(err)
+	t.Equal(want, got)
+
+	_, err = tc.Remember(ctx, "other", Options{}, func(ctx context.Context) (typedItem, error) {
+		return typedItem{}, errors.New("loader error")
+	})
+	t.EqualError(err, "loader error")
+}
+
+func (t *StashTestSuite) TestTypedCache_Many() {
+	c, err := Load(NewMemory(time.Hour, time.Hour))
+	t.NoError(err)
+
+	ctx := context.Background()
+	tc := NewTypedCache[string, int](c)
+
+	t.NoError(tc.SetMany(ctx, map[string]int{"one": 1, "two": 2}, Options{}))
+
+	got, err := tc.GetMany(ctx, "one", "two", "missing")
+	t.NoError(err)
+	t.Equal(map[string]int{"one": 1, "two": 2}, got)
+
+	t.NoError(tc.DeleteMany(ctx, "one", "two"))
+	got, err = tc.GetMany(ctx, "one", "two")
+	t.NoError(err)
+	t.Empty(got)
+
+	t.NoError(c.Set(ctx, "string", "value", Options{}))
+	_, err = tc.GetMany(ctx, "string")
+	t.Error(err)
+}